@@ -0,0 +1,16 @@
+data "git_diff" "release" {
+  hostname     = "github.com"
+  repository   = "test-git-provider"
+  organization = "test-dump"
+  from         = "v1.2.0"
+  to           = "main"
+}
+
+locals {
+  workspaces = ["network", "database", "api"]
+
+  triggered_workspaces = [
+    for w in local.workspaces : w
+    if anytrue([for p in data.git_diff.release.changed_paths : startswith(p, "workspaces/${w}/")])
+  ]
+}
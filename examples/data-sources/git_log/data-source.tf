@@ -0,0 +1,15 @@
+data "git_log" "api" {
+  hostname     = "github.com"
+  repository   = "test-git-provider"
+  organization = "test-dump"
+  from         = "v1.2.0"
+  to           = "main"
+  paths        = ["services/api/"]
+  max_count    = 100
+
+  parse_conventional_commits = true
+}
+
+output "api_release_notes" {
+  value = [for c in data.git_log.api.commits : format("%s (%s)", c.subject, substr(c.sha, 0, 7)) if c.type == "feat" || c.type == "fix"]
+}
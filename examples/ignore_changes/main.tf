@@ -18,11 +18,6 @@ provider "git" {
   token = var.gh_token
 }
 
-provider "github" {
-  owner = "test-dump"
-  token = var.gh_token
-}
-
 locals {
   org  = "test-dump"
   repo = "test-git-provider"
@@ -43,16 +38,6 @@ resource "random_string" "test" {
   lower    = true
 }
 
-resource "github_branch" "test" {
-  lifecycle {
-    ignore_changes = all
-  }
-
-  for_each   = local.branches
-  repository = local.repo
-  branch     = format("%s-%s", each.key, random_string.test[each.key].result)
-}
-
 resource "git_files" "test" {
   lifecycle {
     ignore_changes = [file]
@@ -61,8 +46,12 @@ resource "git_files" "test" {
   hostname     = "github.com"
   repository   = local.repo
   organization = local.org
-  branch       = github_branch.test[each.key].branch
-  force_new    = false
+  branch       = format("%s-%s", each.key, random_string.test[each.key].result)
+  base_ref     = "main"
+
+  create_branch            = true
+  delete_branch_on_destroy = true
+  restore_drift            = false
   author = {
     name    = "trentmillar"
     email   = "1146672+trentmillar@users.noreply.github.com"
@@ -55,6 +55,10 @@ resource "git_files" "unmanaged" {
   repository   = local.repo
   organization = local.org
   branch       = "unmanaged"
+
+  # the file is only created, later changes in the branch are not reverted
+  restore_drift = false
+
   author = {
     name    = "trentmillar"
     email   = "1146672+trentmillar@users.noreply.github.com"
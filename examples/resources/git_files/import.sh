@@ -0,0 +1,5 @@
+# The ID is made of the repository, the branch and a comma separated list of paths, every path can be a glob.
+terraform import git_files.test "github.com/test-dump/test-git-provider:branch_1:src/main.hpp,src/main.cpp"
+
+# For Azure DevOps the project goes between the organization and the repository.
+terraform import git_files.test "dev.azure.com/my-azdo-organization/project-in-azdo/test-git-provider:branch_1:src/**/*.cpp"
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-pax/terraform-provider-git/utils/unique"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// CheckoutPool keeps the working copies of the branches checked out during a run, keyed by the
+// remote and the branch, so resources reading the same branch share a single clone. A working copy
+// is only handed out to the holder of the lock of its branch.
+type CheckoutPool struct {
+	lock      sync.Mutex
+	checkouts map[string]string
+}
+
+var checkoutPools []*CheckoutPool
+var checkoutPoolsLock sync.Mutex
+
+func NewCheckoutPool() *CheckoutPool {
+	pool := &CheckoutPool{
+		checkouts: map[string]string{},
+	}
+	checkoutPoolsLock.Lock()
+	defer checkoutPoolsLock.Unlock()
+	checkoutPools = append(checkoutPools, pool)
+	return pool
+}
+
+// checkout returns a working copy of the branch and its head. The branch is cloned by the first
+// checkout of the run, later ones get the same working copy reset to the head fetched then, until
+// a push invalidates it. The returned function releases the working copy, removing it unless it's
+// kept in the pool. A nil pool clones the branch every time.
+func (p *CheckoutPool) checkout(ctx context.Context, commands *GitCommands, repo string, branch string, project string) (string, string, BranchStatus, func(), error) {
+	key := commands.lockKey(repo, project, branch)
+	if p != nil {
+		p.lock.Lock()
+		checkout_dir, ok := p.checkouts[key]
+		p.lock.Unlock()
+		if ok {
+			head, err := resetCheckout(ctx, checkout_dir, branch)
+			if err == nil {
+				tflog.SubsystemDebug(ctx, LogSubsystem, fmt.Sprintf("Reusing the checkout of %s", key))
+				return checkout_dir, head, Exist, func() {}, nil
+			}
+			tflog.SubsystemWarn(ctx, LogSubsystem, fmt.Sprintf("Failed to reset the checkout of %s, cloning it again: %s", key, err))
+			p.invalidate(key)
+		}
+	}
+
+	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
+	remove := func() {
+		_ = os.RemoveAll(checkout_dir)
+	}
+	head, status, err := commands.checkout(ctx, checkout_dir, repo, branch, project)
+	if p == nil || status != Exist {
+		return checkout_dir, head, status, remove, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.checkouts[key] = checkout_dir
+	return checkout_dir, head, status, func() {}, nil
+}
+
+// invalidate removes the working copy of the key, the next checkout clones the branch again.
+func (p *CheckoutPool) invalidate(key string) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	checkout_dir, ok := p.checkouts[key]
+	delete(p.checkouts, key)
+	p.lock.Unlock()
+	if ok {
+		_ = os.RemoveAll(checkout_dir)
+	}
+}
+
+// removeAll removes every working copy of the pool.
+func (p *CheckoutPool) removeAll() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key, checkout_dir := range p.checkouts {
+		_ = os.RemoveAll(checkout_dir)
+		delete(p.checkouts, key)
+	}
+}
+
+// resetCheckout drops whatever an earlier user of the working copy left behind, staged changes,
+// commits and untracked files, and returns the head of the branch.
+func resetCheckout(ctx context.Context, checkout_dir string, branch string) (string, error) {
+	if _, err := gitCommand(ctx, checkout_dir, "checkout", "-q", "--force", branch, "--"); err != nil {
+		return "", err
+	}
+	if _, err := gitCommand(ctx, checkout_dir, "reset", "-q", "--hard", "refs/remotes/origin/"+branch); err != nil {
+		return "", err
+	}
+	if _, err := gitCommand(ctx, checkout_dir, "clean", "-q", "-fdx"); err != nil {
+		return "", err
+	}
+	out, err := gitCommand(ctx, checkout_dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// RemoveCheckouts removes the working copies kept by every pool, it's meant to be called when the
+// provider stops serving.
+func RemoveCheckouts() {
+	checkoutPoolsLock.Lock()
+	defer checkoutPoolsLock.Unlock()
+	for _, pool := range checkoutPools {
+		pool.removeAll()
+	}
+}
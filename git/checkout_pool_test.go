@@ -0,0 +1,69 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutPool(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, checkout := path.Join(dir, "remote"), path.Join(dir, "checkout")
+	git := func(cwd string, args ...string) string {
+		out, err := gitCommand(ctx, cwd, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimRight(string(out), "\n")
+	}
+	git(dir, "init", "-q", "--bare", "-b", "main", remote)
+	git(dir, "clone", "-q", remote, checkout)
+	git(checkout, "checkout", "-q", "-b", "main")
+	if err := os.WriteFile(path.Join(checkout, "a.txt"), []byte("a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(checkout, "add", "a.txt")
+	git(checkout, "commit", "-qm", "pushed")
+	git(checkout, "push", "-q", "origin", "HEAD")
+	head := git(checkout, "rev-parse", "HEAD")
+
+	commands := NewGitCommands("u", "t", "org", "example.com")
+	pool := NewCheckoutPool()
+	pool.checkouts[commands.lockKey("repo", "", "main")] = checkout
+
+	// what an earlier user may leave behind
+	if err := os.WriteFile(path.Join(checkout, "a.txt"), []byte("changed\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(checkout, "commit", "-qam", "not pushed")
+	if err := os.WriteFile(path.Join(checkout, "b.txt"), []byte("b\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(checkout, "add", "b.txt")
+	if err := os.WriteFile(path.Join(checkout, "c.txt"), []byte("c\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	checkout_dir, rev, status, release, err := pool.checkout(ctx, commands, "repo", "main", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	release()
+	if checkout_dir != checkout || status != Exist || rev != head {
+		t.Fatalf("expected the pooled checkout at %s, got %s at %s (%d)", head, checkout_dir, rev, status)
+	}
+	if out := git(checkout, "status", "--porcelain"); out != "" {
+		t.Errorf("expected a clean checkout, got %q", out)
+	}
+	if _, err := os.Stat(checkout); err != nil {
+		t.Errorf("expected the pooled checkout to be kept after release: %s", err)
+	}
+
+	pool.invalidate(commands.lockKey("repo", "", "main"))
+	if _, err := os.Stat(checkout); !os.IsNotExist(err) {
+		t.Errorf("expected the invalidated checkout to be removed, got %v", err)
+	}
+}
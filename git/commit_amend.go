@@ -0,0 +1,83 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	CommitModeNew   = "new"
+	CommitModeAmend = "amend"
+
+	CommitTrailer = "Terraform-Git-Files"
+)
+
+// commitTrailer returns the trailer identifying the commits of the resource with the given ID.
+func commitTrailer(id string) string {
+	return fmt.Sprintf("%s: %s", CommitTrailer, id)
+}
+
+// hasTrailer returns whether the last paragraph of the commit message, where git keeps trailers,
+// holds the given trailer.
+func hasTrailer(message string, trailer string) bool {
+	paragraphs := strings.Split(strings.TrimRight(message, "\n"), "\n\n")
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if strings.TrimSpace(line) == trailer {
+			return true
+		}
+	}
+	return false
+}
+
+// amendableTip returns the SHA of the commit checked out when it carries the trailer of the
+// resource with the given ID and has a single parent, or an empty string when it can't be
+// replaced.
+func amendableTip(ctx context.Context, checkout_dir string, id string) (string, error) {
+	if _, err := gitOutput(ctx, checkout_dir, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		// a branch created in an empty repository has no commit yet
+		return "", nil
+	}
+	out, err := gitOutput(ctx, checkout_dir, "log", "-1", "--format=%H %P%n%B", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	header, message, _ := strings.Cut(string(out), "\n")
+	shas := strings.Fields(header)
+	if len(shas) != 2 || !hasTrailer(message, commitTrailer(id)) {
+		return "", nil
+	}
+	return shas[0], nil
+}
+
+// amendedBody returns the body of the commit replacing the tip of the branch, listing every file
+// the staged changes differ in from the parent of the tip.
+func amendedBody(ctx context.Context, checkout_dir string) (string, error) {
+	out, err := gitOutput(ctx, checkout_dir, "-c", "core.quotePath=false", "diff", "--cached", "--name-status", "-z", "--find-renames", "HEAD^")
+	if err != nil {
+		return "", err
+	}
+	changes, err := parseDiffNameStatus(string(out))
+	if err != nil {
+		return "", err
+	}
+	var updated_files []string
+	for _, change := range changes {
+		switch change.Status {
+		case ChangeAdded:
+			updated_files = append(updated_files, fmt.Sprintf("+ %s", change.Path))
+		case ChangeDeleted:
+			updated_files = append(updated_files, fmt.Sprintf("- %s", change.Path))
+		case ChangeRenamed:
+			updated_files = append(updated_files, fmt.Sprintf("%s -> %s", change.OldPath, change.Path))
+		default:
+			updated_files = append(updated_files, fmt.Sprintf("~ %s", change.Path))
+		}
+	}
+	if len(updated_files) == 0 {
+		return "No files differ from the parent commit anymore.", nil
+	}
+	sort.Strings(updated_files)
+	return fmt.Sprintf("The following files were updated by terraform:\n%s", strings.Join(updated_files, "\n")), nil
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestHasTrailer(t *testing.T) {
+	trailer := commitTrailer("github.com/org/repo:main:abc")
+	cases := []struct {
+		message  string
+		expected bool
+	}{
+		{"Update files\n\nbody\n\n" + trailer + "\n", true},
+		{"Update files\n\n" + trailer + "\nSigned-off-by: a <a@x>\n", true},
+		{"Update files\n\n" + trailer + "\n\nmore text\n", false},
+		{"Update files\n\n" + commitTrailer("github.com/org/repo:main:def") + "\n", false},
+		{"Update files\n", false},
+	}
+	for _, c := range cases {
+		if actual := hasTrailer(c.message, trailer); actual != c.expected {
+			t.Errorf("hasTrailer(%q): expected %v, got %v", c.message, c.expected, actual)
+		}
+	}
+}
+
+func TestAmendableTip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(filepath string, contents string) {
+		if err := os.WriteFile(path.Join(dir, filepath), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) string {
+		out, err := gitCommand(ctx, dir, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	if tip, err := amendableTip(ctx, dir, "id"); err != nil || tip != "" {
+		t.Fatalf("expected no tip in an empty repository, got %q %v", tip, err)
+	}
+	write("a.txt", "a\n")
+	git("add", "-A")
+	git("commit", "-qm", "init", "-m", commitTrailer("id"))
+	if tip, err := amendableTip(ctx, dir, "id"); err != nil || tip != "" {
+		t.Fatalf("expected a root commit not to be amendable, got %q %v", tip, err)
+	}
+
+	write("b.txt", "b\n")
+	git("add", "-A")
+	git("commit", "-qm", "add b", "-m", commitTrailer("id"))
+	sha := git("rev-parse", "HEAD")
+	tip, err := amendableTip(ctx, dir, "id")
+	if err != nil || tip+"\n" != sha {
+		t.Fatalf("expected tip %q, got %q %v", sha, tip, err)
+	}
+	if tip, _ := amendableTip(ctx, dir, "other"); tip != "" {
+		t.Errorf("expected the commit of another resource not to be amendable, got %q", tip)
+	}
+
+	git("mv", "a.txt", "c.txt")
+	write("d.txt", "d\n")
+	git("add", "-A")
+	body, err := amendedBody(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "The following files were updated by terraform:\n+ b.txt\n+ d.txt\na.txt -> c.txt"
+	if body != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+}
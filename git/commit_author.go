@@ -0,0 +1,86 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-pax/terraform-provider-git/utils/map_type"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	CommitActionCreate = "Create"
+	CommitActionUpdate = "Update"
+	CommitActionDelete = "Delete"
+)
+
+// DefaultCommitMessage is the commit message template used when neither the resource nor the
+// provider sets a message.
+const DefaultCommitMessage = "{action} {files} with Terraform"
+
+// commitAuthor returns the author of the commits of the resource: what its author leaves out is
+// taken from the default_author of the provider, and from the user of the token after that.
+func commitAuthor(d *schema.ResourceData, meta interface{}) (Author, error) {
+	owner := meta.(*Owner)
+	author := map_type.ToTypedObject(d.Get("author").(map[string]interface{}))
+	resolved := Author{
+		Name:    author["name"],
+		Email:   author["email"],
+		Message: author["message"],
+	}
+	if resolved.Name == "" {
+		resolved.Name = owner.defaultAuthor.Name
+	}
+	if resolved.Email == "" {
+		resolved.Email = owner.defaultAuthor.Email
+	}
+	if resolved.Message == "" {
+		resolved.Message = owner.defaultAuthor.Message
+	}
+	if resolved.Message == "" {
+		resolved.Message = DefaultCommitMessage
+	}
+
+	var missing []string
+	if resolved.Name == "" {
+		missing = append(missing, "name")
+	}
+	if resolved.Email == "" {
+		missing = append(missing, "email")
+	}
+	if len(missing) > 0 {
+		err := fmt.Errorf("the commit author has no %s, set it in the author of the resource or the default_author of the provider",
+			strings.Join(missing, " and "))
+		if owner.identityErr != nil {
+			err = fmt.Errorf("%w, the user of the token couldn't be looked up: %s", err, owner.identityErr)
+		}
+		return Author{}, err
+	}
+	return resolved, nil
+}
+
+// commitMessage fills the placeholders of the message template: {action} is Create, Update or
+// Delete, {files} the managed file or their count, {repository} and {branch} those of the resource.
+func commitMessage(template string, action string, d *schema.ResourceData) string {
+	filepaths := filePaths(d.Get("file").(*schema.Set))
+	files := fmt.Sprintf("%d files", len(filepaths))
+	if len(filepaths) == 1 {
+		files = filepaths[0]
+	}
+	return strings.NewReplacer(
+		"{action}", action,
+		"{files}", files,
+		"{repository}", d.Get("repository").(string),
+		"{branch}", d.Get("branch").(string),
+	).Replace(template)
+}
+
+// committerConfig returns the git options making the provider's default author the committer,
+// git's own configuration is used when it isn't known.
+func committerConfig(meta interface{}) []string {
+	owner := meta.(*Owner)
+	if owner.defaultAuthor.Name == "" || owner.defaultAuthor.Email == "" {
+		return nil
+	}
+	return []string{"-c", "user.name=" + owner.defaultAuthor.Name, "-c", "user.email=" + owner.defaultAuthor.Email}
+}
@@ -0,0 +1,75 @@
+package git
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestCommitAuthor(t *testing.T) {
+	resource := func(author map[string]interface{}) *schema.ResourceData {
+		return schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+			"repository": "repo",
+			"branch":     "main",
+			"author":     author,
+		})
+	}
+	owner := &Owner{defaultAuthor: Author{Name: "Bot", Email: "1+bot@users.noreply.github.com"}}
+
+	author, err := commitAuthor(resource(map[string]interface{}{"message": "chore: sync"}), owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Author{Name: "Bot", Email: "1+bot@users.noreply.github.com", Message: "chore: sync"}
+	if author != expected {
+		t.Errorf("expected %+v, got %+v", expected, author)
+	}
+
+	author, err = commitAuthor(resource(map[string]interface{}{"name": "Jane", "email": "jane@example.com"}), owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = Author{Name: "Jane", Email: "jane@example.com", Message: DefaultCommitMessage}
+	if author != expected {
+		t.Errorf("expected %+v, got %+v", expected, author)
+	}
+
+	owner = &Owner{defaultAuthor: Author{Message: "{action} {files}"}, identityErr: errors.New("401 Unauthorized")}
+	_, err = commitAuthor(resource(nil), owner)
+	if err == nil || !strings.Contains(err.Error(), "no name and email") || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("expected an error about the missing name and email, got %v", err)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+		"repository": "repo",
+		"branch":     "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "a.txt", "contents": "a"},
+		},
+	})
+	if actual := commitMessage(DefaultCommitMessage, CommitActionCreate, d); actual != "Create a.txt with Terraform" {
+		t.Errorf("unexpected message %q", actual)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+		"repository": "repo",
+		"branch":     "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "a.txt", "contents": "a"},
+			map[string]interface{}{"filepath": "b.txt", "contents": "b"},
+		},
+	})
+	if actual := commitMessage("{action} {files} in {repository}@{branch}", CommitActionUpdate, d); actual != "Update 2 files in repo@main" {
+		t.Errorf("unexpected message %q", actual)
+	}
+}
+
+func TestNoreplyEmail(t *testing.T) {
+	if actual := noreplyEmail(583231, "octocat"); actual != "583231+octocat@users.noreply.github.com" {
+		t.Errorf("unexpected email %q", actual)
+	}
+}
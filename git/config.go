@@ -2,9 +2,10 @@ package git
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"golang.org/x/oauth2"
 
@@ -13,18 +14,38 @@ import (
 )
 
 type Config struct {
-	Token    string
-	Owner    string
-	Org      string
-	Insecure bool
+	Token               string
+	Owner               string
+	Org                 string
+	Insecure            bool
+	AllowedPathPrefixes []string
+	FileFormat          FileFormat
+	DryRun              *DryRun
+	LockDir             string
+	LockTimeout         time.Duration
+	PushVerifyRetries   int
+	PushVerifyDelay     time.Duration
+	LogTimings          bool
+	DefaultAuthor       Author
 }
 
 type Owner struct {
-	name           string
-	client         *githubv4.Client
-	Context        context.Context
-	IsOrganization bool
-	token          string
+	name                string
+	client              *githubv4.Client
+	Context             context.Context
+	IsOrganization      bool
+	token               string
+	allowedPathPrefixes []string
+	fileFormat          FileFormat
+	dryRun              *DryRun
+	lockDir             string
+	lockTimeout         time.Duration
+	checkouts           *CheckoutPool
+	pushVerifyRetries   int
+	pushVerifyDelay     time.Duration
+	logTimings          bool
+	defaultAuthor       Author
+	identityErr         error
 }
 
 // Meta returns the meta parameter that is passed into subsequent resources
@@ -47,16 +68,24 @@ func (c *Config) Meta() (interface{}, error) {
 	owner.client = qlClient
 
 	owner.token = c.Token
+	owner.allowedPathPrefixes = c.AllowedPathPrefixes
+	owner.fileFormat = c.FileFormat
+	owner.dryRun = c.DryRun
+	owner.lockDir = c.LockDir
+	owner.lockTimeout = c.LockTimeout
+	owner.checkouts = NewCheckoutPool()
+	owner.pushVerifyRetries = c.PushVerifyRetries
+	owner.pushVerifyDelay = c.PushVerifyDelay
+	owner.logTimings = c.LogTimings
+	owner.defaultAuthor = c.DefaultAuthor
 
 	if c.Anonymous() {
-		log.Printf("[INFO] No token present; configuring anonymous owner.")
 		return &owner, nil
 	} else {
 		_, err = c.ConfigureOwner(&owner)
 		if err != nil {
 			return &owner, err
 		}
-		log.Printf("[INFO] Token present; configuring authenticated owner: %s", owner.name)
 		return &owner, nil
 	}
 }
@@ -79,9 +108,49 @@ func (c *Config) ConfigureOwner(owner *Owner) (*Owner, error) {
 		owner.name = query.Viewer.Login
 	}
 
+	if owner.defaultAuthor.Name == "" || owner.defaultAuthor.Email == "" {
+		c.configureDefaultAuthor(ctx, owner)
+	}
+
 	return owner, nil
 }
 
+// configureDefaultAuthor completes the default author with the user of the token. The lookup
+// doesn't fail the configuration: reading the email needs the user:email or read:user scope and
+// the token may be for another host, the error is only reported by commits without author.
+func (c *Config) configureDefaultAuthor(ctx context.Context, owner *Owner) {
+	var query struct {
+		Viewer struct {
+			Login      string
+			Name       string
+			Email      string
+			DatabaseId int64
+		}
+	}
+	if err := owner.client.Query(ctx, &query, nil); err != nil {
+		owner.identityErr = err
+		return
+	}
+	if owner.defaultAuthor.Name == "" {
+		owner.defaultAuthor.Name = query.Viewer.Name
+		if owner.defaultAuthor.Name == "" {
+			owner.defaultAuthor.Name = query.Viewer.Login
+		}
+	}
+	if owner.defaultAuthor.Email == "" {
+		owner.defaultAuthor.Email = query.Viewer.Email
+		if owner.defaultAuthor.Email == "" {
+			owner.defaultAuthor.Email = noreplyEmail(query.Viewer.DatabaseId, query.Viewer.Login)
+		}
+	}
+}
+
+// noreplyEmail returns the noreply address GitHub attributes commits of the user with, used when
+// the user keeps their email private.
+func noreplyEmail(id int64, login string) string {
+	return fmt.Sprintf("%d+%s@users.noreply.github.com", id, login)
+}
+
 func (c *Config) Anonymous() bool {
 	return c.Token == ""
 }
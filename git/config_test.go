@@ -2,6 +2,10 @@ package git
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/shurcooL/githubv4"
@@ -72,3 +76,34 @@ func TestAccConfigMeta(t *testing.T) {
 	})
 
 }
+
+func TestConfigureOwnerWithoutEmailScope(t *testing.T) {
+	// the email of the viewer needs the user:email or read:user scope, which the token lacks
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "email") {
+			w.Write([]byte(`{"data": null, "errors": [{"message": "Your token has not been granted the required scopes to execute this query. The 'email' field requires one of the following scopes: ['user:email', 'read:user']"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"viewer": {"login": "octocat"}}}`))
+	}))
+	defer server.Close()
+
+	config := Config{Token: "token"}
+	owner, err := config.ConfigureOwner(&Owner{client: githubv4.NewEnterpriseClient(server.URL, server.Client())})
+	if err != nil {
+		t.Fatalf("expected the configuration to succeed without the email scope, got %s", err)
+	}
+	if owner.name != "octocat" {
+		t.Errorf("expected the owner octocat, got %q", owner.name)
+	}
+	if owner.identityErr == nil || !strings.Contains(owner.identityErr.Error(), "user:email") {
+		t.Errorf("expected the missing scope in the identity error, got %v", owner.identityErr)
+	}
+
+	// a complete default author needs no lookup of the user
+	owner, err = config.ConfigureOwner(&Owner{client: githubv4.NewEnterpriseClient(server.URL, server.Client()), defaultAuthor: Author{Name: "Bot", Email: "bot@example.com"}})
+	if err != nil || owner.identityErr != nil {
+		t.Errorf("expected no error with a complete default author, got %v and %v", err, owner.identityErr)
+	}
+}
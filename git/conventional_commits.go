@@ -0,0 +1,28 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// https://www.conventionalcommits.org/en/v1.0.0/#specification
+var conventionalHeader = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: +(.+)$`)
+
+var breakingFooter = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+
+// parseConventionalCommit parses the commit message according to the conventional commits
+// specification. It returns false when the subject doesn't follow the specification.
+func parseConventionalCommit(message string) (*ConventionalCommit, bool) {
+	subject, body, _ := strings.Cut(message, "\n")
+	match := conventionalHeader.FindStringSubmatch(strings.TrimSpace(subject))
+	if match == nil {
+		return nil, false
+	}
+
+	return &ConventionalCommit{
+		Type:        strings.ToLower(match[1]),
+		Scope:       strings.TrimSpace(match[2]),
+		Breaking:    match[3] == "!" || breakingFooter.MatchString(body),
+		Description: match[4],
+	}, true
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	cases := []struct {
+		message  string
+		ok       bool
+		expected ConventionalCommit
+	}{
+		{
+			message:  "feat: add git_log data source",
+			ok:       true,
+			expected: ConventionalCommit{Type: "feat", Description: "add git_log data source"},
+		},
+		{
+			message:  "fix(api): handle missing branch",
+			ok:       true,
+			expected: ConventionalCommit{Type: "fix", Scope: "api", Description: "handle missing branch"},
+		},
+		{
+			message:  "refactor(api)!: drop v1 endpoints",
+			ok:       true,
+			expected: ConventionalCommit{Type: "refactor", Scope: "api", Breaking: true, Description: "drop v1 endpoints"},
+		},
+		{
+			message:  "Feat: rename settings\n\nBREAKING CHANGE: the settings file moved",
+			ok:       true,
+			expected: ConventionalCommit{Type: "feat", Breaking: true, Description: "rename settings"},
+		},
+		{
+			message: "Merge pull request #1 from go-pax/main",
+			ok:      false,
+		},
+		{
+			message: "feat:missing space",
+			ok:      false,
+		},
+	}
+
+	for _, c := range cases {
+		actual, ok := parseConventionalCommit(c.message)
+		if ok != c.ok {
+			t.Fatalf("bad: %q parsed %t, expected %t", c.message, ok, c.ok)
+		}
+		if !ok {
+			continue
+		}
+		if *actual != c.expected {
+			t.Fatalf("bad: %q\n\t%#v\n\t%#v", c.message, *actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	ChangeRenamed  = "renamed"
+)
+
+func dataSourceGitDiff() *schema.Resource {
+	s := repositoryDataSourceSchema()
+	s["from"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Required:    true,
+		Description: "Ref (branch, tag or SHA) to compare from.",
+	}
+	s["to"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Default:     "HEAD",
+		Description: "Ref (branch, tag or SHA) to compare to. Defaults to the default branch of the repository.",
+	}
+	s["merge_base"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Compare `to` with the merge base of both refs instead of `from` itself, same as `git diff from...to`.",
+	}
+	s["paths"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "Only compare these paths.",
+	}
+	s["detect_renames"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     true,
+		Description: "Report renamed files as renames instead of a deletion and an addition.",
+	}
+	s["include_patch"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Set the unified `patch` of each changed file.",
+	}
+	s["from_sha"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "Commit SHA `from` resolved to, or the merge base when `merge_base` is set.",
+	}
+	s["to_sha"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "Commit SHA `to` resolved to.",
+	}
+	for _, status := range []string{ChangeAdded, ChangeModified, ChangeDeleted} {
+		s[status] = &schema.Schema{
+			Type:        schema.TypeList,
+			Computed:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: fmt.Sprintf("Paths %s between both refs.", status),
+		}
+	}
+	s[ChangeRenamed] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "Paths renamed between both refs.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"from": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"to": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"similarity": {
+					Type:        schema.TypeInt,
+					Computed:    true,
+					Description: "Percentage of unchanged content.",
+				},
+			},
+		},
+	}
+	s["changed_paths"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "Every path touched between both refs, including both sides of a rename.",
+	}
+	s["files"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "Every changed file.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"path": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"old_path": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Path before the rename, empty unless `status` is `renamed`.",
+				},
+				"status": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "One of `added`, `modified`, `deleted` or `renamed`.",
+				},
+				"patch": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Unified diff of the file, only set when `include_patch` is enabled.",
+				},
+			},
+		},
+	}
+
+	return &schema.Resource{
+		Description: "Computes the paths changed between two refs of a repository.",
+		Schema:      s,
+		ReadContext: dataSourceGitDiffRead,
+	}
+}
+
+func dataSourceGitDiffRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	ctx, checkout_dir, commands, cleanup, diags := cloneRepositoryBare(ctx, "read git_diff", d, meta)
+	if diags.HasError() {
+		return diags
+	}
+	defer cleanup()
+
+	from, err := commands.resolveRef(ctx, checkout_dir, d.Get("from").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	to, err := commands.resolveRef(ctx, checkout_dir, d.Get("to").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if d.Get("merge_base").(bool) {
+		out, err := gitOutput(ctx, checkout_dir, "merge-base", from, to)
+		if err != nil {
+			return diag.Errorf("failed to find merge base of %s and %s: %s", from, to, err)
+		}
+		from = strings.TrimRight(string(out), "\n")
+	}
+
+	var paths []string
+	for _, p := range d.Get("paths").([]interface{}) {
+		paths = append(paths, p.(string))
+	}
+
+	rename_arg := "--no-renames"
+	if d.Get("detect_renames").(bool) {
+		rename_arg = "--find-renames"
+	}
+
+	out, err := gitOutput(ctx, checkout_dir, flatten("-c", "core.quotePath=false", "diff", "--name-status", "-z", rename_arg, from, to, "--", paths)...)
+	if err != nil {
+		return diag.Errorf("failed to diff %s..%s: %s", from, to, err)
+	}
+	changes, err := parseDiffNameStatus(string(out))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	tflog.SubsystemDebug(ctx, LogSubsystem, fmt.Sprintf("Found %d changed files in %s..%s", len(changes), from, to))
+
+	if d.Get("include_patch").(bool) {
+		for i, change := range changes {
+			change_paths := []string{change.Path}
+			if change.OldPath != "" {
+				change_paths = append(change_paths, change.OldPath)
+			}
+			out, err := gitOutput(ctx, checkout_dir, flatten("diff", rename_arg, from, to, "--", change_paths)...)
+			if err != nil {
+				return diag.Errorf("failed to diff %s: %s", change.Path, err)
+			}
+			changes[i].Patch = string(out)
+		}
+	}
+
+	added := []string{}
+	modified := []string{}
+	deleted := []string{}
+	changed_paths := []string{}
+	var renamed []interface{}
+	var files []interface{}
+	for _, change := range changes {
+		switch change.Status {
+		case ChangeAdded:
+			added = append(added, change.Path)
+		case ChangeModified:
+			modified = append(modified, change.Path)
+		case ChangeDeleted:
+			deleted = append(deleted, change.Path)
+		case ChangeRenamed:
+			renamed = append(renamed, map[string]interface{}{
+				"from":       change.OldPath,
+				"to":         change.Path,
+				"similarity": change.Similarity,
+			})
+			changed_paths = append(changed_paths, change.OldPath)
+		}
+		changed_paths = append(changed_paths, change.Path)
+		files = append(files, map[string]interface{}{
+			"path":     change.Path,
+			"old_path": change.OldPath,
+			"status":   change.Status,
+			"patch":    change.Patch,
+		})
+	}
+
+	values := map[string]interface{}{
+		"from_sha":      from,
+		"to_sha":        to,
+		ChangeAdded:     added,
+		ChangeModified:  modified,
+		ChangeDeleted:   deleted,
+		ChangeRenamed:   renamed,
+		"changed_paths": changed_paths,
+		"files":         files,
+	}
+	for k, v := range values {
+		if err := d.Set(k, v); err != nil {
+			return diag.Errorf("failed to set %s: %s", k, err)
+		}
+	}
+	d.SetId(fmt.Sprintf("%s..%s", from, to))
+	return nil
+}
+
+// parseDiffNameStatus parses the output of git diff --name-status -z. Copies are reported as
+// additions and type changes as modifications.
+func parseDiffNameStatus(out string) ([]FileChange, error) {
+	var changes []FileChange
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; i++ {
+		status := fields[i]
+		if i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected end of diff output after status %s", status)
+		}
+		change := FileChange{Path: fields[i+1]}
+		i++
+		switch status[0] {
+		case 'A':
+			change.Status = ChangeAdded
+		case 'M', 'T':
+			change.Status = ChangeModified
+		case 'D':
+			change.Status = ChangeDeleted
+		case 'R', 'C':
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected end of diff output after path %s", change.Path)
+			}
+			change.Similarity, _ = strconv.Atoi(status[1:])
+			if status[0] == 'R' {
+				change.Status = ChangeRenamed
+				change.OldPath = change.Path
+			} else {
+				change.Status = ChangeAdded
+			}
+			change.Path = fields[i+1]
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected diff status %s for %s", status, change.Path)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
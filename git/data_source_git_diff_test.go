@@ -0,0 +1,34 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiffNameStatus(t *testing.T) {
+	out := "M\x00README.md\x00A\x00docs/new file.md\x00D\x00old.txt\x00R087\x00a/b.go\x00a/c.go\x00T\x00link\x00C100\x00x.txt\x00y.txt\x00"
+	expected := []FileChange{
+		{Status: ChangeModified, Path: "README.md"},
+		{Status: ChangeAdded, Path: "docs/new file.md"},
+		{Status: ChangeDeleted, Path: "old.txt"},
+		{Status: ChangeRenamed, Path: "a/c.go", OldPath: "a/b.go", Similarity: 87},
+		{Status: ChangeModified, Path: "link"},
+		{Status: ChangeAdded, Path: "y.txt", Similarity: 100},
+	}
+
+	actual, err := parseDiffNameStatus(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\t%#v", actual, expected)
+	}
+
+	if changes, err := parseDiffNameStatus(""); err != nil || len(changes) != 0 {
+		t.Fatalf("bad: expected no changes for empty output, got %#v, %v", changes, err)
+	}
+
+	if _, err := parseDiffNameStatus("R100\x00a.txt"); err == nil {
+		t.Fatal("expected an error for truncated output")
+	}
+}
@@ -0,0 +1,223 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	logRecordSeparator = "\x1e"
+	logFieldSeparator  = "\x1f"
+)
+
+func dataSourceGitLog() *schema.Resource {
+	s := repositoryDataSourceSchema()
+	s["from"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Ref (branch, tag or SHA) to start from, exclusive. When empty the whole history reachable from `to` is returned.",
+	}
+	s["to"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Default:     "HEAD",
+		Description: "Ref (branch, tag or SHA) to end at, inclusive. Defaults to the default branch of the repository.",
+	}
+	s["paths"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "Only return commits that touched any of these paths.",
+	}
+	s["max_count"] = &schema.Schema{
+		Type:             schema.TypeInt,
+		Optional:         true,
+		ValidateDiagFunc: validateIntAtLeast(1),
+		Description:      "Limits the number of commits returned.",
+	}
+	s["author"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Description: "Only return commits whose author matches this regular expression, same as `git log --author`.",
+	}
+	s["first_parent"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Only follow the first parent of merge commits.",
+	}
+	s["parse_conventional_commits"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Parse the commit messages as conventional commits and set `type`, `scope` and `breaking` of each commit.",
+	}
+	s["commits"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "Commits in reverse chronological order.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"sha": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"subject": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"message": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"author_name": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"author_email": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"date": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Author date in RFC 3339 format.",
+				},
+				"paths": {
+					Type:     schema.TypeList,
+					Computed: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+				},
+				"type": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"scope": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"breaking": {
+					Type:     schema.TypeBool,
+					Computed: true,
+				},
+			},
+		},
+	}
+
+	return &schema.Resource{
+		Description: "Lists the commits between two refs of a repository, optionally limited to some paths.",
+		Schema:      s,
+		ReadContext: dataSourceGitLogRead,
+	}
+}
+
+func dataSourceGitLogRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	ctx, checkout_dir, commands, cleanup, diags := cloneRepositoryBare(ctx, "read git_log", d, meta)
+	if diags.HasError() {
+		return diags
+	}
+	defer cleanup()
+
+	to, err := commands.resolveRef(ctx, checkout_dir, d.Get("to").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	revision_range := to
+	if v, ok := d.GetOk("from"); ok {
+		from, err := commands.resolveRef(ctx, checkout_dir, v.(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		revision_range = fmt.Sprintf("%s..%s", from, to)
+	}
+
+	log_command := flatten("-c", "core.quotePath=false", "log", "--name-only",
+		"--format="+logRecordSeparator+"%H"+logFieldSeparator+"%an"+logFieldSeparator+"%ae"+logFieldSeparator+"%aI"+logFieldSeparator+"%B"+logFieldSeparator)
+	if v, ok := d.GetOk("max_count"); ok {
+		log_command = append(log_command, "--max-count="+strconv.Itoa(v.(int)))
+	}
+	if v, ok := d.GetOk("author"); ok {
+		log_command = append(log_command, "--author="+v.(string))
+	}
+	if d.Get("first_parent").(bool) {
+		log_command = append(log_command, "--first-parent")
+	}
+	log_command = append(log_command, revision_range, "--")
+	for _, p := range d.Get("paths").([]interface{}) {
+		log_command = append(log_command, p.(string))
+	}
+
+	out, err := gitOutput(ctx, checkout_dir, log_command...)
+	if err != nil {
+		return diag.Errorf("failed to read log %s: %s", revision_range, err)
+	}
+	commits := parseGitLog(string(out))
+	tflog.SubsystemDebug(ctx, LogSubsystem, fmt.Sprintf("Found %d commits in %s", len(commits), revision_range))
+
+	parse_conventional := d.Get("parse_conventional_commits").(bool)
+	var result []interface{}
+	for _, c := range commits {
+		commit := map[string]interface{}{
+			"sha":          c.Sha,
+			"subject":      c.Subject,
+			"message":      c.Message,
+			"author_name":  c.AuthorName,
+			"author_email": c.AuthorEmail,
+			"date":         c.Date,
+			"paths":        c.Paths,
+			"type":         "",
+			"scope":        "",
+			"breaking":     false,
+		}
+		if parse_conventional {
+			if cc, ok := parseConventionalCommit(c.Message); ok {
+				commit["type"] = cc.Type
+				commit["scope"] = cc.Scope
+				commit["breaking"] = cc.Breaking
+			}
+		}
+		result = append(result, commit)
+	}
+
+	if err := d.Set("commits", result); err != nil {
+		return diag.Errorf("failed to set commits: %s", err)
+	}
+	d.SetId(revision_range)
+	return nil
+}
+
+// parseGitLog parses the output of git log written with the record and field separators used
+// by dataSourceGitLogRead, followed by the --name-only list of paths.
+func parseGitLog(out string) []Commit {
+	var commits []Commit
+	for _, record := range strings.Split(out, logRecordSeparator) {
+		fields := strings.Split(record, logFieldSeparator)
+		if len(fields) != 6 {
+			continue
+		}
+		message := strings.TrimRight(fields[4], "\n")
+		subject, _, _ := strings.Cut(message, "\n")
+		paths := []string{}
+		for _, p := range strings.Split(fields[5], "\n") {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
+		commits = append(commits, Commit{
+			Sha:         fields[0],
+			AuthorName:  fields[1],
+			AuthorEmail: fields[2],
+			Date:        fields[3],
+			Message:     message,
+			Subject:     subject,
+			Paths:       paths,
+		})
+	}
+	return commits
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGitLog(t *testing.T) {
+	record := func(sha string, message string, names string) string {
+		return logRecordSeparator + sha + logFieldSeparator + "Jane" + logFieldSeparator + "jane@example.com" +
+			logFieldSeparator + "2024-05-01T10:00:00+02:00" + logFieldSeparator + message + logFieldSeparator + names
+	}
+	commit := func(sha string, subject string, message string, paths ...string) Commit {
+		if paths == nil {
+			paths = []string{}
+		}
+		return Commit{
+			Sha:         sha,
+			Subject:     subject,
+			Message:     message,
+			AuthorName:  "Jane",
+			AuthorEmail: "jane@example.com",
+			Date:        "2024-05-01T10:00:00+02:00",
+			Paths:       paths,
+		}
+	}
+
+	cases := []struct {
+		name     string
+		out      string
+		expected []Commit
+	}{
+		{
+			name:     "empty",
+			out:      "",
+			expected: nil,
+		},
+		{
+			name:     "multi-line body",
+			out:      record("a1", "feat: add\n\nbody line\nsecond\n", "\n\nsrc/a.go\nsrc/b.go\n"),
+			expected: []Commit{commit("a1", "feat: add", "feat: add\n\nbody line\nsecond", "src/a.go", "src/b.go")},
+		},
+		{
+			name:     "no paths",
+			out:      record("b2", "empty\n", "\n"),
+			expected: []Commit{commit("b2", "empty", "empty")},
+		},
+		{
+			name:     "non-ASCII paths",
+			out:      record("c3", "docs\n", "\n\nGrüße.txt\n日本/ファイル.md\n"),
+			expected: []Commit{commit("c3", "docs", "docs", "Grüße.txt", "日本/ファイル.md")},
+		},
+		{
+			name: "several commits",
+			out:  record("d4", "fix: one\n", "\n\na.txt\n") + record("e5", "merge\n", "\n"),
+			expected: []Commit{
+				commit("d4", "fix: one", "fix: one", "a.txt"),
+				commit("e5", "merge", "merge"),
+			},
+		},
+	}
+	for _, c := range cases {
+		if actual := parseGitLog(c.out); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: bad: %#v\n\t%#v", c.name, actual, c.expected)
+		}
+	}
+}
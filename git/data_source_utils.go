@@ -0,0 +1,68 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/go-pax/terraform-provider-git/utils/unique"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// repositoryDataSourceSchema returns the attributes every data source uses to locate the repository.
+func repositoryDataSourceSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"hostname": {
+			Type:        schema.TypeString,
+			Default:     "github.com",
+			Optional:    true,
+			Description: "Defaults to `github.com`, set it to whatever git server hosts the repository.",
+		},
+		"repository": {
+			Type:        schema.TypeString,
+			Required:    true,
+			Description: "Respository name you want to read from.",
+		},
+		"organization": {
+			Type:        schema.TypeString,
+			Required:    true,
+			Description: "Sets the organization in git the repository is in.",
+		},
+		"project": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "Sets the AzureDevOps Project where the repository is in. Only needed if using AzDO repos",
+		},
+	}
+}
+
+// cloneRepositoryBare makes a bare clone of the repository described by the data source into a
+// temp dir and returns ctx logging the operation. The caller must call the returned cleanup func
+// once done.
+func cloneRepositoryBare(ctx context.Context, operation string, d *schema.ResourceData, meta interface{}) (context.Context, string, *GitCommands, func(), diag.Diagnostics) {
+	hostname := d.Get("hostname").(string)
+	org := d.Get("organization").(string)
+	repo := d.Get("repository").(string)
+	azdoProject := ""
+	if v, ok := d.GetOk("project"); ok {
+		azdoProject = v.(string)
+	}
+
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, operation, repo, azdoProject, "", meta)
+
+	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
+	cleanup := func() {
+		_ = os.RemoveAll(checkout_dir)
+		done()
+	}
+
+	if err := commands.cloneBare(ctx, checkout_dir, repo, azdoProject); err != nil {
+		cleanup()
+		return ctx, "", nil, nil, gitDiagnostics(err, fmt.Sprintf("failed to clone repository %s", repo))
+	}
+
+	return ctx, checkout_dir, commands, cleanup, nil
+}
@@ -0,0 +1,117 @@
+package git
+
+import (
+	"strings"
+)
+
+const (
+	DefaultMarker      = "# {mark} TERRAFORM MANAGED BLOCK"
+	DefaultMarkerBegin = "BEGIN"
+	DefaultMarkerEnd   = "END"
+)
+
+// fileBlock returns the markers of a file block in managed_block mode, or nil when the block
+// manages the whole file.
+func fileBlock(file map[string]interface{}) *BlockMarkers {
+	if v, _ := file["managed_block"].(bool); !v {
+		return nil
+	}
+	marker, begin, end := DefaultMarker, DefaultMarkerBegin, DefaultMarkerEnd
+	if v, _ := file["marker"].(string); v != "" {
+		marker = v
+	}
+	if v, _ := file["marker_begin"].(string); v != "" {
+		begin = v
+	}
+	if v, _ := file["marker_end"].(string); v != "" {
+		end = v
+	}
+	return &BlockMarkers{
+		Begin: strings.ReplaceAll(marker, "{mark}", begin),
+		End:   strings.ReplaceAll(marker, "{mark}", end),
+	}
+}
+
+// findBlock returns the offsets of the managed block in the text of a file: the start of its
+// begin marker line, the start and end of its contents and the end of its end marker line.
+func findBlock(text string, markers BlockMarkers) (start int, inner_start int, inner_end int, end int, ok bool) {
+	start = -1
+	for offset := 0; offset < len(text); {
+		next := len(text)
+		if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+			next = offset + i + 1
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(text[offset:next], "\n"), "\r")
+		if start < 0 && line == markers.Begin {
+			start, inner_start = offset, next
+		} else if start >= 0 && line == markers.End {
+			return start, inner_start, offset, next, true
+		}
+		offset = next
+	}
+	return 0, 0, 0, 0, false
+}
+
+// blockContents returns the contents between the markers of the managed block.
+func blockContents(text string, markers BlockMarkers) (string, bool) {
+	_, inner_start, inner_end, _, ok := findBlock(text, markers)
+	if !ok {
+		return "", false
+	}
+	return text[inner_start:inner_end], true
+}
+
+// replaceBlock writes the managed block into the text of a file, in place of the existing block
+// or at the end of the file when the markers are absent.
+func replaceBlock(text string, contents string, markers BlockMarkers, newline string) string {
+	block := markers.Begin + newline + contents + markers.End + newline
+	if start, _, _, end, ok := findBlock(text, markers); ok {
+		return text[:start] + block + text[end:]
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += newline
+	}
+	return text + block
+}
+
+// removeBlock removes the managed block and its markers from the text of a file.
+func removeBlock(text string, markers BlockMarkers) (string, bool) {
+	start, _, _, end, ok := findBlock(text, markers)
+	if !ok {
+		return text, false
+	}
+	return text[:start] + text[end:], true
+}
+
+// blockFile returns the bytes of a file once the managed block is written into its current
+// bytes, out is empty when the file doesn't exist yet. The line endings and encoding of the
+// format apply to the whole file.
+func blockFile(out []byte, contents string, markers BlockMarkers, format FileFormat) ([]byte, error) {
+	text := ""
+	if len(out) > 0 {
+		var err error
+		if text, err = decodeContents(out, format.Encoding); err != nil {
+			return nil, err
+		}
+	}
+	newline := "\n"
+	if format.LineEndings == LineEndingsCrlf {
+		newline = "\r\n"
+	}
+	text = replaceBlock(text, normalizeContents(contents, format), markers, newline)
+	return encodeContents(text, FileFormat{LineEndings: format.LineEndings, Encoding: format.Encoding}), nil
+}
+
+// blockMatches returns whether the file read from the checkout still has the managed block, and
+// whether the block holds the contents kept in state.
+func blockMatches(out []byte, stored string, markers BlockMarkers, format FileFormat) (bool, bool) {
+	text, err := decodeContents(out, format.Encoding)
+	if err != nil {
+		return false, false
+	}
+	contents, ok := blockContents(text, markers)
+	if !ok {
+		return false, false
+	}
+	return true, textMatches(contents, stored, format)
+}
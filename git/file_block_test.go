@@ -0,0 +1,92 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestFileBlock(t *testing.T) {
+	if markers := fileBlock(map[string]interface{}{"filepath": "a"}); markers != nil {
+		t.Errorf("expected no markers for a whole file, got %+v", markers)
+	}
+	expected := BlockMarkers{Begin: "# BEGIN TERRAFORM MANAGED BLOCK", End: "# END TERRAFORM MANAGED BLOCK"}
+	if markers := fileBlock(map[string]interface{}{"managed_block": true}); markers == nil || *markers != expected {
+		t.Errorf("expected %+v, got %+v", expected, markers)
+	}
+	expected = BlockMarkers{Begin: "<!-- start infra -->", End: "<!-- stop infra -->"}
+	file := map[string]interface{}{"managed_block": true, "marker": "<!-- {mark} infra -->", "marker_begin": "start", "marker_end": "stop"}
+	if markers := fileBlock(file); markers == nil || *markers != expected {
+		t.Errorf("expected %+v, got %+v", expected, markers)
+	}
+}
+
+func TestReplaceBlock(t *testing.T) {
+	markers := BlockMarkers{Begin: "# BEGIN", End: "# END"}
+	cases := []struct {
+		text     string
+		contents string
+		newline  string
+		expected string
+	}{
+		{"", "a\n", "\n", "# BEGIN\na\n# END\n"},
+		{"keep\n", "a\n", "\n", "keep\n# BEGIN\na\n# END\n"},
+		{"keep", "a\n", "\n", "keep\n# BEGIN\na\n# END\n"},
+		{"top\n# BEGIN\nold\n# END\nbottom\n", "a\nb\n", "\n", "top\n# BEGIN\na\nb\n# END\nbottom\n"},
+		{"top\r\n# BEGIN\r\nold\r\n# END\r\nbottom\r\n", "a\r\n", "\r\n", "top\r\n# BEGIN\r\na\r\n# END\r\nbottom\r\n"},
+		{"# BEGIN\nno end\n", "a\n", "\n", "# BEGIN\nno end\n# BEGIN\na\n# END\n"},
+		{"# BEGIN\n# END", "", "\n", "# BEGIN\n# END\n"},
+	}
+	for _, c := range cases {
+		if actual := replaceBlock(c.text, c.contents, markers, c.newline); actual != c.expected {
+			t.Errorf("replaceBlock(%q, %q): expected %q, got %q", c.text, c.contents, c.expected, actual)
+		}
+	}
+}
+
+func TestRemoveBlock(t *testing.T) {
+	markers := BlockMarkers{Begin: "# BEGIN", End: "# END"}
+	cases := []struct {
+		text     string
+		expected string
+		found    bool
+	}{
+		{"top\n# BEGIN\na\n# END\nbottom\n", "top\nbottom\n", true},
+		{"# BEGIN\na\n# END\n", "", true},
+		{"top\n# BEGIN\na\n", "top\n# BEGIN\na\n", false},
+	}
+	for _, c := range cases {
+		actual, found := removeBlock(c.text, markers)
+		if actual != c.expected || found != c.found {
+			t.Errorf("removeBlock(%q): expected %q %v, got %q %v", c.text, c.expected, c.found, actual, found)
+		}
+	}
+}
+
+func TestBlockMatches(t *testing.T) {
+	markers := BlockMarkers{Begin: "# BEGIN", End: "# END"}
+	format := fileFormat(map[string]interface{}{"managed_block": true}, FileFormat{})
+	out, err := blockFile([]byte("human\n"), "a", markers, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "human\n# BEGIN\na\n# END\n" {
+		t.Errorf("unexpected file: %q", out)
+	}
+
+	cases := []struct {
+		out     string
+		stored  string
+		found   bool
+		matches bool
+	}{
+		{"edited\n# BEGIN\na\n# END\nmore\n", "a", true, true},
+		{"# BEGIN\nb\n# END\n", "a", true, false},
+		{"# BEGIN\na\n# END\n", stateContents(ContentsSha256, "a\n"), true, true},
+		{"human\n", "a", false, false},
+	}
+	for _, c := range cases {
+		found, matches := blockMatches([]byte(c.out), c.stored, markers, format)
+		if found != c.found || matches != c.matches {
+			t.Errorf("blockMatches(%q, %q): expected %v %v, got %v %v", c.out, c.stored, c.found, c.matches, found, matches)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	ContentsFull       = "full"
+	ContentsSha256     = "sha256"
+	ContentsGitBlobSha = "git_blob_sha"
+)
+
+var contentsHashRegexp = regexp.MustCompile(`^(sha256:[0-9a-f]{64}|git_blob_sha:[0-9a-f]{40})$`)
+
+// stateContents returns what is kept in state for the contents of a file: the contents
+// themselves, or their hash prefixed with the algorithm. Hashed contents are returned as is.
+func stateContents(mode string, contents string) string {
+	if mode == "" || mode == ContentsFull {
+		return contents
+	}
+	if strings.HasPrefix(contents, mode+":") && contentsHashRegexp.MatchString(contents) {
+		return contents
+	}
+	switch mode {
+	case ContentsSha256:
+		sum := sha256.Sum256([]byte(contents))
+		return ContentsSha256 + ":" + hex.EncodeToString(sum[:])
+	case ContentsGitBlobSha:
+		return ContentsGitBlobSha + ":" + gitBlobSha(contents)
+	}
+	return contents
+}
+
+// fileStateContents returns what is kept in state for the contents of a file block. Hashes are
+// computed from the contents normalized to the format of the block, without the defaults of the
+// provider: the set hash and the diff suppression compare them to the configured contents without
+// the provider configuration. textMatches undoes the defaults when comparing them with a file.
+func fileStateContents(file map[string]interface{}) string {
+	mode, _ := file["contents_in_state"].(string)
+	contents, _ := file["contents"].(string)
+	if mode == "" || mode == ContentsFull || stateContents(mode, contents) == contents {
+		return contents
+	}
+	return stateContents(mode, normalizeContents(contents, fileFormat(file, FileFormat{})))
+}
+
+// contentsMatch returns true when the contents kept in state, hashed or not, are the given
+// contents.
+func contentsMatch(stored string, contents string) bool {
+	if stored == contents {
+		return true
+	}
+	if !contentsHashRegexp.MatchString(stored) {
+		return false
+	}
+	mode, _, _ := strings.Cut(stored, ":")
+	return stateContents(mode, contents) == stored
+}
+
+// suppressContents hides the difference between the contents kept in state and the configured
+// contents when they are the same once normalized to the format of the file block, or when
+// state only holds their hash. The contents of a block removed from the set are never suppressed,
+// the SDK would keep the block in the diff otherwise.
+func suppressContents(k, old, new string, d *schema.ResourceData) bool {
+	prefix := strings.TrimSuffix(k, "contents")
+	if !plannedFile(prefix, d) {
+		return false
+	}
+	format := fileFormat(map[string]interface{}{
+		"line_endings":            d.Get(prefix + "line_endings"),
+		"ensure_trailing_newline": d.Get(prefix + "ensure_trailing_newline"),
+		"encoding":                d.Get(prefix + "encoding"),
+		"managed_block":           d.Get(prefix + "managed_block"),
+	}, FileFormat{})
+	if contentsHashRegexp.MatchString(old) {
+		return contentsMatch(old, new) || contentsMatch(old, normalizeContents(new, format))
+	}
+	return normalizeContents(old, format) == normalizeContents(new, format)
+}
+
+// plannedFile returns whether the file block at the prefix, e.g. "file.1234.", is still in the
+// planned set.
+func plannedFile(prefix string, d *schema.ResourceData) bool {
+	code := strings.TrimSuffix(strings.TrimPrefix(prefix, "file."), ".")
+	files := d.Get("file").(*schema.Set)
+	for _, v := range files.List() {
+		if strconv.Itoa(files.F(v)) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSetHash hashes file blocks by the contents kept in state, so a block keeps its place in
+// the set whether it holds the configured contents or their hash. Contents only differing in
+// what the format of the block normalizes hash the same, the defaults of the provider aren't
+// known here and apply the same to the configured and stored blocks.
+func fileSetHash(file_resource *schema.Resource) schema.SchemaSetFunc {
+	hash := schema.HashResource(file_resource)
+	return func(v interface{}) int {
+		file := map[string]interface{}{}
+		for k, v := range v.(map[string]interface{}) {
+			file[k] = v
+		}
+		mode, _ := file["contents_in_state"].(string)
+		if mode == "" {
+			mode = ContentsFull
+		}
+		file["contents_in_state"] = mode
+		if mode == ContentsFull {
+			contents, _ := file["contents"].(string)
+			file["contents"] = normalizeContents(contents, fileFormat(file, FileFormat{}))
+		} else {
+			file["contents"] = fileStateContents(file)
+		}
+		return hash(file)
+	}
+}
+
+// configContents returns the configured contents of the managed files keyed by path. State
+// only holds the hash of files with contents_in_state set, their contents are read from the
+// raw config instead.
+func configContents(d *schema.ResourceData) map[string]string {
+	return rawConfigContents(d.Get("file").(*schema.Set), d.GetRawConfig())
+}
+
+// rawConfigContents returns the contents of the file blocks, read from the raw config when
+// it's known.
+func rawConfigContents(files *schema.Set, config cty.Value) map[string]string {
+	contents := fileContents(files)
+	if config.IsNull() || !config.IsKnown() || !config.Type().IsObjectType() || !config.Type().HasAttribute("file") {
+		return contents
+	}
+	config_files := config.GetAttr("file")
+	if config_files.IsNull() || !config_files.IsKnown() {
+		return contents
+	}
+	for it := config_files.ElementIterator(); it.Next(); {
+		_, file := it.Element()
+		filepath, file_contents := file.GetAttr("filepath"), file.GetAttr("contents")
+		if filepath.IsKnown() && !filepath.IsNull() && file_contents.IsKnown() && !file_contents.IsNull() {
+			contents[filepath.AsString()] = file_contents.AsString()
+		}
+	}
+	return contents
+}
+
+// unknownContents returns the paths of files only known by the hash of their contents.
+func unknownContents(files *schema.Set, contents map[string]string) []string {
+	var filepaths []string
+	for _, v := range files.List() {
+		file := v.(map[string]interface{})
+		filepath := file["filepath"].(string)
+		mode, _ := file["contents_in_state"].(string)
+		if mode != "" && mode != ContentsFull && contents[filepath] == stateContents(mode, contents[filepath]) {
+			filepaths = append(filepaths, filepath)
+		}
+	}
+	return filepaths
+}
+
+// setStateContents replaces the contents of the file blocks with what is kept in state.
+func setStateContents(d *schema.ResourceData) error {
+	var files []interface{}
+	for _, v := range d.Get("file").(*schema.Set).List() {
+		file := map[string]interface{}{}
+		for k, v := range v.(map[string]interface{}) {
+			file[k] = v
+		}
+		file["contents"] = fileStateContents(file)
+		files = append(files, file)
+	}
+	return d.Set("file", files)
+}
+
+// filesChanged returns true when the planned file blocks differ from the ones in state. Blocks
+// are compared by their set hash, the configured contents of a block only kept as a hash in state
+// differ from it without being a change.
+func filesChanged(d *schema.ResourceDiff) bool {
+	if !d.HasChange("file") {
+		return false
+	}
+	if !d.NewValueKnown("file") {
+		return true
+	}
+	o, _ := d.GetChange("file")
+	old_files, new_files := o.(*schema.Set), plannedFiles(d)
+	return old_files.Difference(new_files).Len() > 0 || new_files.Difference(old_files).Len() > 0
+}
+
+// plannedFiles returns the planned file blocks. schema.ResourceDiff doesn't read the patch block
+// of the set elements which changed, the patches are read from the raw config instead.
+func plannedFiles(d *schema.ResourceDiff) *schema.Set {
+	files := d.Get("file").(*schema.Set)
+	patches := configPatches(d.GetRawConfig())
+	var planned []interface{}
+	for _, v := range files.List() {
+		file := map[string]interface{}{}
+		for k, v := range v.(map[string]interface{}) {
+			file[k] = v
+		}
+		if patch, ok := patches[file["filepath"].(string)]; ok {
+			file["patch"] = patch
+		}
+		planned = append(planned, file)
+	}
+	return schema.NewSet(files.F, planned)
+}
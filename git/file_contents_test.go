@@ -0,0 +1,107 @@
+package git
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestStateContents(t *testing.T) {
+	cases := []struct {
+		mode     string
+		contents string
+		expected string
+	}{
+		{ContentsFull, "hello\n", "hello\n"},
+		{"", "hello\n", "hello\n"},
+		{ContentsSha256, "hello\n", "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{ContentsGitBlobSha, "hello\n", "git_blob_sha:ce013625030ba8dba906f756967f9e9ca394464a"},
+		{ContentsSha256, "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{ContentsGitBlobSha, "git_blob_sha:ce013625030ba8dba906f756967f9e9ca394464a", "git_blob_sha:ce013625030ba8dba906f756967f9e9ca394464a"},
+	}
+	for _, c := range cases {
+		if actual := stateContents(c.mode, c.contents); actual != c.expected {
+			t.Errorf("stateContents(%q, %q): expected %q, got %q", c.mode, c.contents, c.expected, actual)
+		}
+	}
+}
+
+func TestContentsMatch(t *testing.T) {
+	cases := []struct {
+		stored   string
+		contents string
+		expected bool
+	}{
+		{"hello\n", "hello\n", true},
+		{"hello\n", "hello", false},
+		{"sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "hello\n", true},
+		{"sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "hello", false},
+		{"git_blob_sha:ce013625030ba8dba906f756967f9e9ca394464a", "hello\n", true},
+		{"git_blob_sha:ce013625030ba8dba906f756967f9e9ca394464a", "hello", false},
+	}
+	for _, c := range cases {
+		if actual := contentsMatch(c.stored, c.contents); actual != c.expected {
+			t.Errorf("contentsMatch(%q, %q): expected %v, got %v", c.stored, c.contents, c.expected, actual)
+		}
+	}
+}
+
+func TestFileSetHash(t *testing.T) {
+	file_resource := resourceGitFilesSchema()["file"].Elem.(*schema.Resource)
+	hash := fileSetHash(file_resource)
+
+	configured := map[string]interface{}{"filepath": "a.json", "contents": "hello\n", "contents_in_state": ContentsSha256}
+	stored := map[string]interface{}{"filepath": "a.json", "contents": stateContents(ContentsSha256, "hello\n"), "contents_in_state": ContentsSha256}
+	if hash(configured) != hash(stored) {
+		t.Errorf("expected configured and stored file to hash the same")
+	}
+
+	full := map[string]interface{}{"filepath": "a.json", "contents": "hello\n", "contents_in_state": ContentsFull}
+	if hash(configured) == hash(full) {
+		t.Errorf("expected files with different contents_in_state to hash differently")
+	}
+	unset := map[string]interface{}{"filepath": "a.json", "contents": "hello\n"}
+	if hash(unset) != hash(full) {
+		t.Errorf("expected files without contents_in_state to keep their full contents")
+	}
+}
+
+func TestHashedContentsWithProviderDefaults(t *testing.T) {
+	defaults := FileFormat{LineEndings: LineEndingsCrlf, EnsureTrailingNewline: true}
+	for _, mode := range []string{ContentsSha256, ContentsGitBlobSha} {
+		file := map[string]interface{}{"filepath": "a.txt", "contents": "a\nb", "contents_in_state": mode}
+		stored := fileStateContents(file)
+		format := fileFormat(file, defaults)
+		written := encodeContents("a\nb", format)
+		if string(written) != "a\r\nb\r\n" {
+			t.Fatalf("unexpected file written with the provider defaults: %q", written)
+		}
+
+		cases := []struct {
+			out      string
+			expected bool
+		}{
+			{string(written), true},
+			{"a\nb\n", true},
+			{"a\nb", true},
+			{"a\r\nc\r\n", false},
+		}
+		for _, c := range cases {
+			if actual := fileMatches([]byte(c.out), stored, format); actual != c.expected {
+				t.Errorf("fileMatches(%q, %s): expected %v, got %v", c.out, stored, c.expected, actual)
+			}
+		}
+
+		dir := t.TempDir()
+		if err := os.WriteFile(path.Join(dir, "a.txt"), []byte("a\nb\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		file["contents"] = stored
+		entry := &TreeEntry{Mode: regularFileMode, Sha: gitBlobSha("a\nb\n")}
+		if drift := fileDrift(dir, file, defaults, entry, gitBlobSha(string(written))); drift != "" {
+			t.Errorf("expected no drift of %s contents with other line endings, got %q", mode, drift)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	LineEndingsPreserve = "preserve"
+	LineEndingsLf       = "lf"
+	LineEndingsCrlf     = "crlf"
+
+	EncodingUtf8    = "utf-8"
+	EncodingUtf8Bom = "utf-8-bom"
+	EncodingUtf16le = "utf-16le"
+
+	utf8Bom = "\xef\xbb\xbf"
+)
+
+// fileFormat returns the format of a file block, the options not set on the block fall back to
+// the ones of the provider.
+func fileFormat(file map[string]interface{}, defaults FileFormat) FileFormat {
+	format := defaults
+	if v, _ := file["line_endings"].(string); v != "" {
+		format.LineEndings = v
+	}
+	if v, _ := file["ensure_trailing_newline"].(bool); v {
+		format.EnsureTrailingNewline = true
+	}
+	if v, _ := file["managed_block"].(bool); v {
+		// the end marker starts on its own line
+		format.EnsureTrailingNewline = true
+	}
+	if v, _ := file["encoding"].(string); v != "" {
+		format.Encoding = v
+	}
+	return format
+}
+
+// normalizeContents applies the line endings and trailing newline of the format to the text of
+// a file.
+func normalizeContents(contents string, format FileFormat) string {
+	if format.EnsureTrailingNewline && contents != "" && !strings.HasSuffix(contents, "\n") {
+		contents += "\n"
+	}
+	switch format.LineEndings {
+	case LineEndingsLf:
+		contents = strings.ReplaceAll(contents, "\r\n", "\n")
+	case LineEndingsCrlf:
+		contents = strings.ReplaceAll(strings.ReplaceAll(contents, "\r\n", "\n"), "\n", "\r\n")
+	}
+	return contents
+}
+
+// encodeContents returns the bytes written to the checkout for the contents of a file.
+func encodeContents(contents string, format FileFormat) []byte {
+	contents = normalizeContents(contents, format)
+	switch format.Encoding {
+	case EncodingUtf8Bom:
+		return []byte(utf8Bom + strings.TrimPrefix(contents, utf8Bom))
+	case EncodingUtf16le:
+		units := utf16.Encode([]rune(strings.TrimPrefix(contents, utf8Bom)))
+		out := make([]byte, 2, 2+2*len(units))
+		binary.LittleEndian.PutUint16(out, 0xfeff)
+		for _, u := range units {
+			out = binary.LittleEndian.AppendUint16(out, u)
+		}
+		return out
+	}
+	return []byte(contents)
+}
+
+// decodeContents returns the text of a file read from the checkout.
+func decodeContents(out []byte, encoding string) (string, error) {
+	switch encoding {
+	case EncodingUtf8Bom:
+		return strings.TrimPrefix(string(out), utf8Bom), nil
+	case EncodingUtf16le:
+		if len(out)%2 != 0 {
+			return "", fmt.Errorf("odd number of bytes in UTF-16 file")
+		}
+		units := make([]uint16, 0, len(out)/2)
+		for i := 0; i < len(out); i += 2 {
+			units = append(units, binary.LittleEndian.Uint16(out[i:]))
+		}
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	if !utf8.Valid(out) {
+		return "", fmt.Errorf("file is not valid UTF-8")
+	}
+	return string(out), nil
+}
+
+// fileMatches returns true when the file read from the checkout holds the contents kept in
+// state, once both are normalized to the format.
+func fileMatches(out []byte, stored string, format FileFormat) bool {
+	text, err := decodeContents(out, format.Encoding)
+	if err != nil {
+		return false
+	}
+	return textMatches(text, stored, format)
+}
+
+// textMatches returns true when the text holds the contents kept in state, once both are
+// normalized to the format. Hashes are of the contents normalized to the format of the file block
+// alone, so the line endings and trailing newline the provider defaults add are undone first.
+func textMatches(text string, stored string, format FileFormat) bool {
+	if contentsHashRegexp.MatchString(stored) {
+		if contentsMatch(stored, text) {
+			return true
+		}
+		for _, contents := range unnormalizedContents(normalizeContents(text, format), format) {
+			if contentsMatch(stored, contents) {
+				return true
+			}
+		}
+		return false
+	}
+	return normalizeContents(text, format) == normalizeContents(stored, format)
+}
+
+// unnormalizedContents returns the contents normalizing to the text with the format, with either
+// line endings and with or without the trailing newline the format ensures.
+func unnormalizedContents(text string, format FileFormat) []string {
+	contents := []string{text}
+	if format.LineEndings != "" {
+		contents = append(contents,
+			normalizeContents(text, FileFormat{LineEndings: LineEndingsLf}),
+			normalizeContents(text, FileFormat{LineEndings: LineEndingsCrlf}))
+	}
+	if format.EnsureTrailingNewline {
+		for _, c := range contents {
+			if trimmed := strings.TrimSuffix(c, "\n"); trimmed != c {
+				contents = append(contents, strings.TrimSuffix(trimmed, "\r"))
+			}
+		}
+	}
+	return contents
+}
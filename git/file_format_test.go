@@ -0,0 +1,84 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContents(t *testing.T) {
+	cases := []struct {
+		contents string
+		format   FileFormat
+		expected string
+	}{
+		{"a\r\nb", FileFormat{LineEndings: LineEndingsPreserve}, "a\r\nb"},
+		{"a\r\nb\n", FileFormat{LineEndings: LineEndingsLf}, "a\nb\n"},
+		{"a\r\nb\n", FileFormat{LineEndings: LineEndingsCrlf}, "a\r\nb\r\n"},
+		{"a", FileFormat{EnsureTrailingNewline: true}, "a\n"},
+		{"a\n", FileFormat{EnsureTrailingNewline: true}, "a\n"},
+		{"", FileFormat{EnsureTrailingNewline: true}, ""},
+		{"a", FileFormat{LineEndings: LineEndingsCrlf, EnsureTrailingNewline: true}, "a\r\n"},
+	}
+	for _, c := range cases {
+		if actual := normalizeContents(c.contents, c.format); actual != c.expected {
+			t.Errorf("normalizeContents(%q, %+v): expected %q, got %q", c.contents, c.format, c.expected, actual)
+		}
+	}
+}
+
+func TestEncodeContents(t *testing.T) {
+	cases := []struct {
+		contents string
+		format   FileFormat
+		expected []byte
+	}{
+		{"hé\n", FileFormat{Encoding: EncodingUtf8}, []byte("hé\n")},
+		{"hé\n", FileFormat{Encoding: EncodingUtf8Bom}, []byte("\xef\xbb\xbfhé\n")},
+		{"\ufeffhé\n", FileFormat{Encoding: EncodingUtf8Bom}, []byte("\xef\xbb\xbfhé\n")},
+		{"hé\n", FileFormat{Encoding: EncodingUtf16le}, []byte{0xff, 0xfe, 'h', 0, 0xe9, 0, '\n', 0}},
+		{"a\n", FileFormat{Encoding: EncodingUtf16le, LineEndings: LineEndingsCrlf}, []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0}},
+	}
+	for _, c := range cases {
+		actual := encodeContents(c.contents, c.format)
+		if !bytes.Equal(actual, c.expected) {
+			t.Errorf("encodeContents(%q, %+v): expected %v, got %v", c.contents, c.format, c.expected, actual)
+		}
+		decoded, err := decodeContents(actual, c.format.Encoding)
+		if err != nil {
+			t.Errorf("decodeContents(%v): %s", actual, err)
+		} else if expected := strings.TrimPrefix(normalizeContents(c.contents, c.format), utf8Bom); decoded != expected {
+			t.Errorf("decodeContents(%v): expected %q, got %q", actual, expected, decoded)
+		}
+	}
+
+	if _, err := decodeContents([]byte{0xff, 0xfe, 'a'}, EncodingUtf16le); err == nil {
+		t.Errorf("expected an error for an odd number of UTF-16 bytes")
+	}
+}
+
+func TestFileMatches(t *testing.T) {
+	crlf := FileFormat{LineEndings: LineEndingsCrlf, Encoding: EncodingUtf8}
+	cases := []struct {
+		out      []byte
+		stored   string
+		format   FileFormat
+		expected bool
+	}{
+		{[]byte("a\nb\n"), "a\nb\n", FileFormat{}, true},
+		{[]byte("a\r\nb\r\n"), "a\nb\n", FileFormat{}, false},
+		{[]byte("a\r\nb\r\n"), "a\nb\n", crlf, true},
+		{[]byte("a\nb\n"), "a\nb\n", crlf, true},
+		{[]byte("a\nb\n"), "a\nc\n", crlf, false},
+		{[]byte("a"), "a", FileFormat{EnsureTrailingNewline: true}, true},
+		{[]byte("\xef\xbb\xbfa\n"), "a\n", FileFormat{Encoding: EncodingUtf8Bom}, true},
+		{[]byte{0xff, 0xfe, 'a', 0, '\n', 0}, "a\n", FileFormat{Encoding: EncodingUtf16le}, true},
+		{[]byte{0xff, 0xfe, 'a', 0, '\n', 0}, stateContents(ContentsSha256, "a\n"), FileFormat{Encoding: EncodingUtf16le}, true},
+		{[]byte("a\n"), "a\n", FileFormat{Encoding: EncodingUtf16le}, false},
+	}
+	for _, c := range cases {
+		if actual := fileMatches(c.out, c.stored, c.format); actual != c.expected {
+			t.Errorf("fileMatches(%q, %q, %+v): expected %v, got %v", c.out, c.stored, c.format, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,861 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PatchJson = "json"
+	PatchYaml = "yaml"
+	PatchToml = "toml"
+
+	tomlDateTag     = "!toml-local-date"
+	tomlTimeTag     = "!toml-local-time"
+	tomlDateTimeTag = "!toml-local-datetime"
+)
+
+// filePatch returns the patch of a file block, or nil when the block manages the whole file. The
+// format defaults to the one of the file extension.
+func filePatch(file map[string]interface{}) *FilePatch {
+	v, _ := file["patch"].([]interface{})
+	if len(v) == 0 || v[0] == nil {
+		return nil
+	}
+	p := v[0].(map[string]interface{})
+	patch := &FilePatch{}
+	if patch.Format, _ = p["format"].(string); patch.Format == "" {
+		filepath, _ := file["filepath"].(string)
+		patch.Format = patchFormat(filepath)
+	}
+	set, _ := p["set"].([]interface{})
+	for _, v := range set {
+		if op, ok := v.(map[string]interface{}); ok {
+			patch.Set = append(patch.Set, PatchOperation{Path: op["path"].(string), Value: op["value"].(string)})
+		}
+	}
+	del, _ := p["delete"].([]interface{})
+	for _, v := range del {
+		if pointer, ok := v.(string); ok {
+			patch.Delete = append(patch.Delete, pointer)
+		}
+	}
+	return patch
+}
+
+// configPatches returns the patch blocks of the raw config keyed by file path, in the shape
+// schema.ResourceData reads them. Patches which aren't known yet are left out.
+func configPatches(config cty.Value) map[string]interface{} {
+	patches := map[string]interface{}{}
+	if config.IsNull() || !config.IsKnown() || !config.Type().IsObjectType() || !config.Type().HasAttribute("file") {
+		return patches
+	}
+	files := config.GetAttr("file")
+	if files.IsNull() || !files.IsKnown() {
+		return patches
+	}
+	for it := files.ElementIterator(); it.Next(); {
+		_, file := it.Element()
+		filepath, v := file.GetAttr("filepath"), file.GetAttr("patch")
+		if !filepath.IsKnown() || filepath.IsNull() || !v.IsWhollyKnown() {
+			continue
+		}
+		patch := []interface{}{}
+		if v.IsNull() {
+			patches[filepath.AsString()] = patch
+			continue
+		}
+		for it := v.ElementIterator(); it.Next(); {
+			_, p := it.Element()
+			format, set, del := "", []interface{}{}, []interface{}{}
+			if v := p.GetAttr("format"); !v.IsNull() {
+				format = v.AsString()
+			}
+			if v := p.GetAttr("set"); !v.IsNull() {
+				for it := v.ElementIterator(); it.Next(); {
+					_, op := it.Element()
+					set = append(set, map[string]interface{}{"path": op.GetAttr("path").AsString(), "value": op.GetAttr("value").AsString()})
+				}
+			}
+			if v := p.GetAttr("delete"); !v.IsNull() {
+				for it := v.ElementIterator(); it.Next(); {
+					_, pointer := it.Element()
+					del = append(del, pointer.AsString())
+				}
+			}
+			patch = append(patch, map[string]interface{}{"format": format, "set": set, "delete": del})
+		}
+		patches[filepath.AsString()] = patch
+	}
+	return patches
+}
+
+// patchFormat returns the patch format of a file by its extension, or an empty string.
+func patchFormat(filepath string) string {
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".json":
+		return PatchJson
+	case ".yaml", ".yml":
+		return PatchYaml
+	case ".toml":
+		return PatchToml
+	}
+	return ""
+}
+
+// validatePatch returns an error when the patch can't be applied whatever the file holds.
+func validatePatch(filepath string, patch FilePatch) error {
+	if patch.Format == "" {
+		return fmt.Errorf("can't tell the patch format of %s from its extension, set format", filepath)
+	}
+	seen := map[string]bool{}
+	for _, op := range patch.Set {
+		if _, err := parsePointer(op.Path); err != nil {
+			return err
+		}
+		if _, err := jsonNode(op.Value); err != nil {
+			return fmt.Errorf("invalid JSON value for %s: %w", op.Path, err)
+		}
+		if seen[patchKey(op)] {
+			return fmt.Errorf("%s is patched twice", op.Path)
+		}
+		seen[patchKey(op)] = true
+	}
+	for _, pointer := range patch.Delete {
+		if _, err := parsePointer(pointer); err != nil {
+			return err
+		}
+		if strings.HasSuffix(pointer, "/-") {
+			return fmt.Errorf("can't delete the end of a list: %s", pointer)
+		}
+		if seen[pointer] {
+			return fmt.Errorf("%s is patched twice", pointer)
+		}
+		seen[pointer] = true
+	}
+	return nil
+}
+
+// patchKey identifies an operation in the original values, items appended to a list are
+// identified by their value.
+func patchKey(op PatchOperation) string {
+	if strings.HasSuffix(op.Path, "/-") {
+		if n, err := jsonNode(op.Value); err == nil {
+			if value, err := nodeJson(n); err == nil {
+				return op.Path + "=" + value
+			}
+		}
+	}
+	return op.Path
+}
+
+// parsePointer splits a JSON pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q, it must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// applyPatch sets and deletes the patched keys in the text of a file. The text is returned as
+// is when the patch doesn't change anything.
+func applyPatch(text string, patch FilePatch) (string, error) {
+	doc, err := decodeDocument(text, patch.Format)
+	if err != nil {
+		return "", err
+	}
+	root := doc.Content[0]
+	changed := false
+	for _, op := range patch.Set {
+		value, err := jsonNode(op.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid JSON value for %s: %w", op.Path, err)
+		}
+		tokens, err := parsePointer(op.Path)
+		if err != nil {
+			return "", err
+		}
+		set, err := setPointer(root, tokens, value)
+		if err != nil {
+			return "", fmt.Errorf("failed to set %s: %w", op.Path, err)
+		}
+		changed = changed || set
+	}
+	for _, pointer := range patch.Delete {
+		tokens, err := parsePointer(pointer)
+		if err != nil {
+			return "", err
+		}
+		changed = deletePointer(root, tokens) || changed
+	}
+	if !changed {
+		return text, nil
+	}
+	return encodeDocument(doc, patch.Format, text)
+}
+
+// patchMatches returns true when the text of a file holds every patched key: set keys have the
+// configured value, appended items are in their list and deleted keys are absent.
+func patchMatches(text string, patch FilePatch) (bool, error) {
+	doc, err := decodeDocument(text, patch.Format)
+	if err != nil {
+		return false, err
+	}
+	root := doc.Content[0]
+	for _, op := range patch.Set {
+		value, err := jsonNode(op.Value)
+		if err != nil {
+			return false, err
+		}
+		tokens, _ := parsePointer(op.Path)
+		if strings.HasSuffix(op.Path, "/-") {
+			if list, ok := getPointer(root, tokens[:len(tokens)-1]); !ok || !containsNode(list, value) {
+				return false, nil
+			}
+			continue
+		}
+		if current, ok := getPointer(root, tokens); !ok || !nodesEqual(current, value) {
+			return false, nil
+		}
+	}
+	for _, pointer := range patch.Delete {
+		tokens, _ := parsePointer(pointer)
+		if _, ok := getPointer(root, tokens); ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// patchOriginals returns the JSON value every patched key has in the text of a file keyed by
+// patchKey, an empty string when the key is absent.
+func patchOriginals(text string, patch FilePatch) (map[string]string, error) {
+	doc, err := decodeDocument(text, patch.Format)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	originals := map[string]string{}
+	record := func(key string, pointer string) error {
+		tokens, _ := parsePointer(pointer)
+		current, ok := getPointer(root, tokens)
+		if !ok {
+			originals[key] = ""
+			return nil
+		}
+		original, err := nodeJson(current)
+		originals[key] = original
+		return err
+	}
+	for _, op := range patch.Set {
+		if !strings.HasSuffix(op.Path, "/-") {
+			if err := record(op.Path, op.Path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// an item already in the list is kept on revert
+		value, err := jsonNode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		tokens, _ := parsePointer(op.Path)
+		originals[patchKey(op)] = ""
+		if list, ok := getPointer(root, tokens[:len(tokens)-1]); ok && containsNode(list, value) {
+			originals[patchKey(op)], _ = nodeJson(value)
+		}
+	}
+	for _, pointer := range patch.Delete {
+		if err := record(pointer, pointer); err != nil {
+			return nil, err
+		}
+	}
+	return originals, nil
+}
+
+// revertPatch puts back the original value of the patched keys not in keep, keys that were absent
+// are deleted. It also returns whether nothing is left in the file.
+func revertPatch(text string, patch FilePatch, originals map[string]string, keep map[string]bool) (string, bool, error) {
+	doc, err := decodeDocument(text, patch.Format)
+	if err != nil {
+		return "", false, err
+	}
+	root := doc.Content[0]
+	changed := false
+	restore := func(pointer string, original string) error {
+		tokens, _ := parsePointer(pointer)
+		if original == "" {
+			if deletePointer(root, tokens) {
+				changed = true
+				pruneMappings(root, tokens[:len(tokens)-1])
+			}
+			return nil
+		}
+		value, err := jsonNode(original)
+		if err != nil {
+			return err
+		}
+		set, err := setPointer(root, tokens, value)
+		changed = changed || set
+		return err
+	}
+	for _, op := range patch.Set {
+		if keep[patchKey(op)] {
+			continue
+		}
+		if strings.HasSuffix(op.Path, "/-") {
+			if originals[patchKey(op)] == "" {
+				// the item was appended by terraform
+				value, err := jsonNode(op.Value)
+				if err != nil {
+					return "", false, err
+				}
+				tokens, _ := parsePointer(op.Path)
+				if removeItem(root, tokens[:len(tokens)-1], value) {
+					changed = true
+					pruneMappings(root, tokens[:len(tokens)-1])
+				}
+			}
+			continue
+		}
+		if err := restore(op.Path, originals[op.Path]); err != nil {
+			return "", false, fmt.Errorf("failed to revert %s: %w", op.Path, err)
+		}
+	}
+	for _, pointer := range patch.Delete {
+		if keep[pointer] || originals[pointer] == "" {
+			continue
+		}
+		if err := restore(pointer, originals[pointer]); err != nil {
+			return "", false, fmt.Errorf("failed to revert %s: %w", pointer, err)
+		}
+	}
+	empty := len(root.Content) == 0
+	if !changed {
+		return text, empty, nil
+	}
+	text, err = encodeDocument(doc, patch.Format, text)
+	return text, empty, err
+}
+
+// getPointer returns the node a JSON pointer references.
+func getPointer(node *yaml.Node, tokens []string) (*yaml.Node, bool) {
+	for _, token := range tokens {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := mappingIndex(node, token)
+			if i < 0 {
+				return nil, false
+			}
+			node = node.Content[i+1]
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil, false
+			}
+			node = node.Content[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// setPointer sets the node a JSON pointer references, missing parents are created as mappings.
+// A last token of `-` appends the value to a list unless it's already there. It returns whether
+// the document changed.
+func setPointer(node *yaml.Node, tokens []string, value *yaml.Node) (bool, error) {
+	for i, token := range tokens {
+		last := i == len(tokens)-1
+		switch node.Kind {
+		case yaml.MappingNode:
+			j := mappingIndex(node, token)
+			if j < 0 {
+				child := value
+				if !last {
+					child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}, child)
+				if last {
+					return true, nil
+				}
+				node = child
+				continue
+			}
+			if last {
+				if nodesEqual(node.Content[j+1], value) {
+					return false, nil
+				}
+				// keep the comments of the replaced value
+				value.HeadComment, value.LineComment, value.FootComment = node.Content[j+1].HeadComment, node.Content[j+1].LineComment, node.Content[j+1].FootComment
+				node.Content[j+1] = value
+				return true, nil
+			}
+			node = node.Content[j+1]
+		case yaml.SequenceNode:
+			if token == "-" && last {
+				if containsNode(node, value) {
+					return false, nil
+				}
+				node.Content = append(node.Content, value)
+				return true, nil
+			}
+			j, err := strconv.Atoi(token)
+			if err != nil || j < 0 || j >= len(node.Content) {
+				return false, fmt.Errorf("no item %q in list", token)
+			}
+			if last {
+				if nodesEqual(node.Content[j], value) {
+					return false, nil
+				}
+				node.Content[j] = value
+				return true, nil
+			}
+			node = node.Content[j]
+		default:
+			return false, fmt.Errorf("%q is not in a mapping or a list", token)
+		}
+	}
+	return false, errors.New("the whole document can't be replaced")
+}
+
+// deletePointer deletes the node a JSON pointer references and returns whether it existed.
+func deletePointer(node *yaml.Node, tokens []string) bool {
+	parent, ok := getPointer(node, tokens[:len(tokens)-1])
+	if !ok {
+		return false
+	}
+	token := tokens[len(tokens)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if i := mappingIndex(parent, token); i >= 0 {
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return true
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(parent.Content) {
+			parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pruneMappings deletes the mappings along a JSON pointer left empty, from the deepest one up,
+// they were created to hold a patched key.
+func pruneMappings(root *yaml.Node, tokens []string) {
+	for i := len(tokens); i > 0; i-- {
+		node, ok := getPointer(root, tokens[:i])
+		if !ok || node.Kind != yaml.MappingNode || len(node.Content) > 0 {
+			return
+		}
+		deletePointer(root, tokens[:i])
+	}
+}
+
+// containsNode returns true when the list has an item equal to value.
+func containsNode(list *yaml.Node, value *yaml.Node) bool {
+	if list.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, item := range list.Content {
+		if nodesEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeItem removes the first item equal to value from the list a JSON pointer references and
+// returns whether it was there.
+func removeItem(node *yaml.Node, tokens []string, value *yaml.Node) bool {
+	list, ok := getPointer(node, tokens)
+	if !ok || list.Kind != yaml.SequenceNode {
+		return false
+	}
+	for i, item := range list.Content {
+		if nodesEqual(item, value) {
+			list.Content = append(list.Content[:i], list.Content[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// mappingIndex returns the index of the key in the content of a mapping node, or -1.
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// nodesEqual compares the JSON values of two nodes, whatever their style.
+func nodesEqual(a *yaml.Node, b *yaml.Node) bool {
+	x, err := nodeJson(a)
+	if err != nil {
+		return false
+	}
+	y, err := nodeJson(b)
+	return err == nil && x == y
+}
+
+// nodeJson returns the compact JSON encoding of a node, mapping keys are sorted.
+func nodeJson(node *yaml.Node) (string, error) {
+	if node.Tag == tomlDateTag || node.Tag == tomlTimeTag || node.Tag == tomlDateTimeTag {
+		b, err := json.Marshal(node.Value)
+		return string(b), err
+	}
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(jsonValue(v))
+	return string(b), err
+}
+
+// jsonValue converts the values decoded from YAML to values json.Marshal accepts.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	}
+	return v
+}
+
+// jsonNode parses a JSON value into a node, keeping the order of object keys and the text of
+// numbers.
+func jsonNode(value string) (*yaml.Node, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	node, err := decodeJsonNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return node, nil
+}
+
+func decodeJsonNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		if v == '{' {
+			node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJsonNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)}, value)
+			}
+			_, err := decoder.Token()
+			return node, err
+		}
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for decoder.More() {
+			value, err := decodeJsonNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		_, err := decoder.Token()
+		return node, err
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+// decodeDocument parses the text of a file into a document node holding its root value, the root
+// value of an empty file is an empty mapping.
+func decodeDocument(text string, format string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	var root *yaml.Node
+	switch format {
+	case PatchJson:
+		if strings.TrimSpace(text) != "" {
+			var err error
+			if root, err = jsonNode(text); err != nil {
+				return nil, err
+			}
+		}
+	case PatchYaml:
+		decoder := yaml.NewDecoder(strings.NewReader(text))
+		if err := decoder.Decode(doc); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err := decoder.Decode(&yaml.Node{}); err != io.EOF {
+			return nil, errors.New("only files with a single YAML document can be patched")
+		}
+		doc.Kind = yaml.DocumentNode
+		if len(doc.Content) > 0 && doc.Content[0].Tag != "!!null" {
+			root = doc.Content[0]
+		}
+	case PatchToml:
+		var v map[string]interface{}
+		if err := toml.Unmarshal([]byte(text), &v); err != nil {
+			return nil, err
+		}
+		root = tomlNode(v)
+	default:
+		return nil, fmt.Errorf("unsupported patch format %q", format)
+	}
+	if root == nil {
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	doc.Content = []*yaml.Node{root}
+	return doc, nil
+}
+
+// encodeDocument writes a document back in the format of the file. JSON and YAML keep the
+// indentation of the original text, YAML also keeps its comments and TOML is edited in place.
+func encodeDocument(doc *yaml.Node, format string, original string) (string, error) {
+	node := doc.Content[0]
+	switch format {
+	case PatchJson:
+		var b strings.Builder
+		if err := writeJsonNode(&b, node, textIndent(original, "  "), 0); err != nil {
+			return "", err
+		}
+		if original == "" || strings.HasSuffix(original, "\n") {
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+	case PatchYaml:
+		var b bytes.Buffer
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(len(textIndent(original, "  ")))
+		if err := encoder.Encode(doc); err != nil {
+			return "", err
+		}
+		if err := encoder.Close(); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	case PatchToml:
+		v, err := tomlValue(node)
+		if err != nil {
+			return "", err
+		}
+		return editToml(original, v.(map[string]interface{}))
+	}
+	return "", fmt.Errorf("unsupported patch format %q", format)
+}
+
+// textIndent returns the indentation of the first indented line of a text.
+func textIndent(text string, fallback string) string {
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && trimmed != line && !strings.HasPrefix(trimmed, "#") {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return fallback
+}
+
+// writeJsonNode writes a node as indented JSON.
+func writeJsonNode(b *strings.Builder, node *yaml.Node, indent string, level int) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			b.WriteString(open + close)
+			return nil
+		}
+		b.WriteString(open + "\n")
+		for i := 0; i < len(node.Content); i += step {
+			b.WriteString(strings.Repeat(indent, level+1))
+			if step == 2 {
+				key, _ := json.Marshal(node.Content[i].Value)
+				b.Write(key)
+				b.WriteString(": ")
+			}
+			if err := writeJsonNode(b, node.Content[i+step-1], indent, level+1); err != nil {
+				return err
+			}
+			if i+step < len(node.Content) {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.Repeat(indent, level) + close)
+		return nil
+	case yaml.ScalarNode:
+		if (node.Tag == "!!int" || node.Tag == "!!float") && json.Valid([]byte(node.Value)) {
+			// numbers keep their text
+			b.WriteString(node.Value)
+			return nil
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if node.Tag == "!!str" {
+			if err := encoder.Encode(node.Value); err != nil {
+				return err
+			}
+		} else {
+			value, err := nodeJson(node)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(value)
+		}
+		b.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+		return nil
+	}
+	return fmt.Errorf("unexpected node kind %d", node.Kind)
+}
+
+// tomlNode converts the values decoded from TOML to a node, keys are sorted.
+func tomlNode(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, tomlNode(v[k]))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, e := range v {
+			node.Content = append(node.Content, tomlNode(e))
+		}
+		return node
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v, 10)}
+	case float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	case time.Time:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: v.Format(time.RFC3339Nano)}
+	case toml.LocalDate:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tomlDateTag, Value: v.String()}
+	case toml.LocalTime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tomlTimeTag, Value: v.String()}
+	case toml.LocalDateTime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tomlDateTimeTag, Value: v.String()}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprint(v)}
+}
+
+// tomlValue converts a node back to the values decoded from TOML.
+func tomlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v, err := tomlValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		l := []interface{}{}
+		for _, e := range node.Content {
+			v, err := tomlValue(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!str":
+			return node.Value, nil
+		case "!!int":
+			return strconv.ParseInt(node.Value, 10, 64)
+		case "!!float":
+			return strconv.ParseFloat(node.Value, 64)
+		case "!!bool":
+			return strconv.ParseBool(node.Value)
+		case "!!timestamp":
+			return time.Parse(time.RFC3339Nano, node.Value)
+		case tomlDateTag:
+			var d toml.LocalDate
+			err := d.UnmarshalText([]byte(node.Value))
+			return d, err
+		case tomlTimeTag:
+			var t toml.LocalTime
+			err := t.UnmarshalText([]byte(node.Value))
+			return t, err
+		case tomlDateTimeTag:
+			var t toml.LocalDateTime
+			err := t.UnmarshalText([]byte(node.Value))
+			return t, err
+		case "!!null":
+			return nil, errors.New("TOML has no null value")
+		}
+	}
+	return nil, fmt.Errorf("unexpected value %q", node.Value)
+}
@@ -0,0 +1,199 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestFilePatch(t *testing.T) {
+	if patch := filePatch(map[string]interface{}{"filepath": "a.json"}); patch != nil {
+		t.Errorf("expected no patch for a whole file, got %+v", patch)
+	}
+	file := map[string]interface{}{"filepath": "conf/app.YML", "patch": []interface{}{map[string]interface{}{
+		"set":    []interface{}{map[string]interface{}{"path": "/a", "value": "1"}},
+		"delete": []interface{}{"/b"},
+	}}}
+	patch := filePatch(file)
+	if patch == nil || patch.Format != PatchYaml || len(patch.Set) != 1 || patch.Set[0].Path != "/a" || len(patch.Delete) != 1 {
+		t.Errorf("unexpected patch %+v", patch)
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	cases := []struct {
+		patch FilePatch
+		valid bool
+	}{
+		{FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a/b", Value: `"x"`}}, Delete: []string{"/c"}}, true},
+		{FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a/-", Value: `"x"`}, {Path: "/a/-", Value: `"y"`}}}, true},
+		{FilePatch{Set: []PatchOperation{{Path: "/a", Value: "1"}}}, false},
+		{FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "a", Value: "1"}}}, false},
+		{FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a", Value: "x"}}}, false},
+		{FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a", Value: "1"}}, Delete: []string{"/a"}}, false},
+		{FilePatch{Format: PatchJson, Delete: []string{"/a/-"}}, false},
+	}
+	for _, c := range cases {
+		if err := validatePatch("f", c.patch); (err == nil) != c.valid {
+			t.Errorf("validatePatch(%+v): expected valid %v, got %v", c.patch, c.valid, err)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	cases := []struct {
+		text     string
+		patch    FilePatch
+		expected string
+	}{
+		{
+			"{\n    \"name\": \"pkg\",\n    \"private\": true,\n    \"scripts\": {\n        \"test\": \"jest\"\n    }\n}\n",
+			FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/scripts/build", Value: `"tsc"`}}, Delete: []string{"/private"}},
+			"{\n    \"name\": \"pkg\",\n    \"scripts\": {\n        \"test\": \"jest\",\n        \"build\": \"tsc\"\n    }\n}\n",
+		},
+		{
+			"",
+			FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a/b", Value: `1.50`}}},
+			"{\n  \"a\": {\n    \"b\": 1.50\n  }\n}\n",
+		},
+		{
+			"# settings\nname: app # the name\nitems:\n  - a\n",
+			FilePatch{Format: PatchYaml, Set: []PatchOperation{{Path: "/items/-", Value: `"b"`}, {Path: "/name", Value: `"web"`}}},
+			"# settings\nname: web # the name\nitems:\n  - a\n  - b\n",
+		},
+		{
+			"items:\n  - a\n",
+			FilePatch{Format: PatchYaml, Set: []PatchOperation{{Path: "/items/-", Value: `"a"`}}},
+			"items:\n  - a\n",
+		},
+		{
+			"[server]\nport = 80\n",
+			FilePatch{Format: PatchToml, Set: []PatchOperation{{Path: "/server/port", Value: `8080`}, {Path: "/server/host", Value: `"x"`}}},
+			"[server]\nport = 8080\nhost = 'x'\n",
+		},
+	}
+	for _, c := range cases {
+		actual, err := applyPatch(c.text, c.patch)
+		if err != nil {
+			t.Errorf("applyPatch(%q): %s", c.text, err)
+		} else if actual != c.expected {
+			t.Errorf("applyPatch(%q): expected %q, got %q", c.text, c.expected, actual)
+		}
+	}
+	if _, err := applyPatch("items:\n  - a\n", FilePatch{Format: PatchYaml, Set: []PatchOperation{{Path: "/items/x", Value: "1"}}}); err == nil {
+		t.Errorf("expected an error setting a key of a list")
+	}
+}
+
+func TestApplyTomlPatch(t *testing.T) {
+	text := `# settings
+title = "app" # shown in the UI
+
+[server]
+port = 80
+hosts = [
+  "a", # first
+  "b",
+]
+
+[[plugins]]
+name = "x"
+
+[database]
+url = "pg://"
+`
+	cases := []struct {
+		patch    FilePatch
+		expected string
+	}{
+		{
+			FilePatch{Format: PatchToml, Set: []PatchOperation{{Path: "/server/port", Value: `8080`}, {Path: "/server/hosts/-", Value: `"c"`}}},
+			"# settings\ntitle = \"app\" # shown in the UI\n\n[server]\nport = 8080\nhosts = [\n  \"a\", # first\n  \"b\",\n  'c',\n]\n\n[[plugins]]\nname = \"x\"\n\n[database]\nurl = \"pg://\"\n",
+		},
+		{
+			FilePatch{Format: PatchToml, Set: []PatchOperation{{Path: "/plugins/0/enabled", Value: `true`}, {Path: "/server/tls/cert", Value: `"c.pem"`}, {Path: "/debug", Value: `false`}}},
+			"# settings\ntitle = \"app\" # shown in the UI\ndebug = false\n\n[server]\nport = 80\nhosts = [\n  \"a\", # first\n  \"b\",\n]\ntls.cert = 'c.pem'\n\n[[plugins]]\nname = \"x\"\nenabled = true\n\n[database]\nurl = \"pg://\"\n",
+		},
+		{
+			FilePatch{Format: PatchToml, Delete: []string{"/title", "/database"}},
+			"# settings\n\n[server]\nport = 80\nhosts = [\n  \"a\", # first\n  \"b\",\n]\n\n[[plugins]]\nname = \"x\"\n",
+		},
+	}
+	for _, c := range cases {
+		actual, err := applyPatch(text, c.patch)
+		if err != nil {
+			t.Errorf("applyPatch(%v): %s", c.patch, err)
+		} else if actual != c.expected {
+			t.Errorf("applyPatch(%v): expected %q, got %q", c.patch, c.expected, actual)
+		}
+	}
+	if _, err := applyPatch(text, FilePatch{Format: PatchToml, Set: []PatchOperation{{Path: "/plugins/-", Value: `{"name": "y"}`}}}); err == nil {
+		t.Errorf("expected an error adding a table to an array of tables")
+	}
+}
+
+func TestPatchMatches(t *testing.T) {
+	patch := FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/a", Value: `{"b": 1}`}, {Path: "/l/-", Value: `"x"`}}, Delete: []string{"/c"}}
+	cases := []struct {
+		text    string
+		matches bool
+	}{
+		{`{"a": {"b": 1}, "l": ["y", "x"], "d": 2}`, true},
+		{`{"l": ["x"], "a": {"b": 1}}`, true},
+		{`{"a": {"b": 2}, "l": ["x"]}`, false},
+		{`{"a": {"b": 1}, "l": ["y"]}`, false},
+		{`{"a": {"b": 1}, "l": ["x"], "c": null}`, false},
+	}
+	for _, c := range cases {
+		matches, err := patchMatches(c.text, patch)
+		if err != nil {
+			t.Errorf("patchMatches(%q): %s", c.text, err)
+		} else if matches != c.matches {
+			t.Errorf("patchMatches(%q): expected %v, got %v", c.text, c.matches, matches)
+		}
+	}
+}
+
+func TestRevertPatch(t *testing.T) {
+	cases := []struct {
+		text     string
+		patch    FilePatch
+		expected string
+		empty    bool
+	}{
+		{
+			"{\n  \"name\": \"pkg\",\n  \"private\": true,\n  \"scripts\": {\n    \"test\": \"jest\"\n  }\n}\n",
+			FilePatch{Format: PatchJson, Set: []PatchOperation{{Path: "/scripts/build", Value: `"tsc"`}, {Path: "/name", Value: `"app"`}}, Delete: []string{"/private"}},
+			"{\n  \"name\": \"pkg\",\n  \"scripts\": {\n    \"test\": \"jest\"\n  },\n  \"private\": true\n}\n",
+			false,
+		},
+		{
+			"# settings\nitems:\n  - a\n",
+			FilePatch{Format: PatchYaml, Set: []PatchOperation{{Path: "/items/-", Value: `"b"`}, {Path: "/extra/enabled", Value: `true`}}},
+			"# settings\nitems:\n  - a\n",
+			false,
+		},
+		{
+			"",
+			FilePatch{Format: PatchToml, Set: []PatchOperation{{Path: "/server/port", Value: `8080`}}},
+			"",
+			true,
+		},
+	}
+	for _, c := range cases {
+		originals, err := patchOriginals(c.text, c.patch)
+		if err != nil {
+			t.Errorf("patchOriginals(%q): %s", c.text, err)
+			continue
+		}
+		patched, err := applyPatch(c.text, c.patch)
+		if err != nil {
+			t.Errorf("applyPatch(%q): %s", c.text, err)
+			continue
+		}
+		actual, empty, err := revertPatch(patched, c.patch, originals, nil)
+		if err != nil {
+			t.Errorf("revertPatch(%q): %s", patched, err)
+		} else if empty != c.empty || !empty && actual != c.expected {
+			t.Errorf("revertPatch(%q): expected %q %v, got %q %v", patched, c.expected, c.empty, actual, empty)
+		}
+	}
+}
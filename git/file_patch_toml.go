@@ -0,0 +1,444 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// tomlEntry is a key/value or a table header of a TOML text. start is the start of its line and
+// line_end the end of its last line, the value of a key/value is at [value, end). The last item
+// of an array value is at [item, item_end) when it's a string, number or date.
+type tomlEntry struct {
+	kind     unstable.Kind
+	path     []string
+	start    int
+	value    int
+	end      int
+	line_end int
+	item     int
+	item_end int
+}
+
+// textEdit replaces the text at [start, end).
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// editToml changes a TOML text to hold the values v in place: changed values are rewritten where
+// they are, deleted keys and tables are removed with their lines and new keys are added at the
+// end of the table holding them. Comments, the order of the keys and the quoting of the values
+// that don't change are kept.
+func editToml(text string, v map[string]interface{}) (string, error) {
+	var old map[string]interface{}
+	if err := toml.Unmarshal([]byte(text), &old); err != nil {
+		return "", err
+	}
+	entries, err := tomlEntries(text, old)
+	if err != nil {
+		return "", err
+	}
+
+	// without root key/values, new ones go before the first table and the comments above it
+	root := len(text)
+	for _, entry := range entries {
+		if entry.kind != unstable.KeyValue {
+			root = entry.start
+			for root > 0 {
+				line := lineStart(text, root-1)
+				if !strings.HasPrefix(strings.TrimLeft(text[line:root], " \t"), "#") {
+					break
+				}
+				root = line
+			}
+		}
+		break
+	}
+
+	var edits []textEdit
+	leaves := map[string]bool{}
+	defined := map[string]bool{}
+	sections := map[string]int{"": root}
+	section := []string{}
+	skip := false
+	for i, entry := range entries {
+		if entry.kind == unstable.KeyValue {
+			if skip {
+				continue
+			}
+			leaves[tomlKeyPath(entry.path)] = true
+			sections[tomlKeyPath(section)] = entry.line_end
+			value, ok := tomlLookup(v, entry.path)
+			if !ok {
+				edits = append(edits, textEdit{start: entry.start, end: entry.line_end})
+				continue
+			}
+			for j := range entry.path {
+				defined[tomlKeyPath(entry.path[:j+1])] = true
+			}
+			original, _ := tomlLookup(old, entry.path)
+			if tomlEqual(original, value) {
+				continue
+			}
+			edit, err := tomlValueEdit(text, entry, original, value)
+			if err != nil {
+				return "", err
+			}
+			edits = append(edits, edit)
+			continue
+		}
+
+		section = entry.path
+		if entry.kind == unstable.ArrayTable {
+			tables := entry.path[:len(entry.path)-1]
+			original, _ := tomlLookup(old, tables)
+			value, ok := tomlLookup(v, tables)
+			if _, is_array := value.([]interface{}); ok && (!is_array || len(value.([]interface{})) != len(original.([]interface{}))) {
+				return "", fmt.Errorf("tables can't be added to or removed from the array of tables %s in place", strings.Join(tables, "."))
+			}
+		}
+		if _, ok := tomlLookup(v, entry.path); !ok {
+			skip = true
+			end := len(text)
+			for _, next := range entries[i+1:] {
+				if next.kind != unstable.KeyValue {
+					end = next.start
+					break
+				}
+			}
+			start := entry.start
+			if end == len(text) {
+				for start > 1 && text[start-2] == '\n' {
+					start--
+				}
+			}
+			edits = append(edits, textEdit{start: start, end: end})
+			continue
+		}
+		skip = false
+		sections[tomlKeyPath(entry.path)] = entry.line_end
+		for j := range entry.path {
+			defined[tomlKeyPath(entry.path[:j+1])] = true
+		}
+	}
+
+	inserts := map[int]string{}
+	var add func(path []string, section []string, m map[string]interface{}) error
+	add = func(path []string, section []string, m map[string]interface{}) error {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := append(append([]string{}, path...), k)
+			key := tomlKeyPath(child)
+			if leaves[key] {
+				continue
+			}
+			if defined[key] {
+				child_section := section
+				if _, ok := sections[key]; ok {
+					child_section = child
+				}
+				switch value := m[k].(type) {
+				case map[string]interface{}:
+					if err := add(child, child_section, value); err != nil {
+						return err
+					}
+				case []interface{}:
+					for i, e := range value {
+						element := append(append([]string{}, child...), strconv.Itoa(i))
+						if table, ok := e.(map[string]interface{}); ok {
+							if err := add(element, element, table); err != nil {
+								return err
+							}
+						}
+					}
+				}
+				continue
+			}
+			lines, err := tomlLines(child[len(section):], m[k])
+			if err != nil {
+				return err
+			}
+			inserts[sections[tomlKeyPath(section)]] += lines
+		}
+		return nil
+	}
+	if err := add([]string{}, []string{}, v); err != nil {
+		return "", err
+	}
+	for start, lines := range inserts {
+		if start == len(text) && start > 0 && !strings.HasSuffix(text, "\n") {
+			lines = "\n" + lines
+		} else if start == root && start < len(text) {
+			lines += "\n"
+		}
+		edits = append(edits, textEdit{start: start, end: start, text: lines})
+	}
+	if len(edits) == 0 {
+		return text, nil
+	}
+
+	// deletions are applied before the insertions at their start
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+	edited := text
+	for _, edit := range edits {
+		edited = edited[:edit.start] + edit.text + edited[edit.end:]
+	}
+
+	var actual map[string]interface{}
+	if err := toml.Unmarshal([]byte(edited), &actual); err != nil || !tomlEqual(actual, v) {
+		return "", fmt.Errorf("the TOML file can't be patched in place")
+	}
+	return edited, nil
+}
+
+// tomlValueEdit rewrites the value of a key/value, items appended to an array of strings, numbers
+// or dates are added after its last item to keep the layout and comments of the array.
+func tomlValueEdit(text string, entry tomlEntry, original interface{}, value interface{}) (textEdit, error) {
+	items, _ := original.([]interface{})
+	appended, _ := value.([]interface{})
+	if entry.item_end == 0 || len(items) == 0 || len(appended) <= len(items) || !tomlEqual(items, appended[:len(items)]) {
+		encoded, err := tomlInline(value)
+		return textEdit{start: entry.value, end: entry.end, text: encoded}, err
+	}
+
+	edit := textEdit{start: entry.item_end, end: entry.item_end}
+	multiline := strings.Contains(text[entry.value:entry.end], "\n")
+	indent := text[lineStart(text, entry.item):entry.item]
+	indent = indent[:len(indent)-len(strings.TrimLeft(indent, " \t"))]
+	comma := strings.HasPrefix(strings.TrimLeft(text[entry.item_end:], " \t"), ",")
+	if multiline && comma {
+		edit.start = entry.item_end + strings.IndexByte(text[entry.item_end:], ',') + 1
+		edit.end = edit.start
+	}
+	for _, item := range appended[len(items):] {
+		encoded, err := tomlInline(item)
+		if err != nil {
+			return textEdit{}, err
+		}
+		switch {
+		case multiline && comma:
+			edit.text += "\n" + indent + encoded + ","
+		case multiline:
+			edit.text += ",\n" + indent + encoded
+		default:
+			edit.text += ", " + encoded
+		}
+	}
+	return edit, nil
+}
+
+// tomlEntries lists the key/values and table headers of a TOML text. Their paths hold the index
+// of the tables of arrays of tables, which are looked up in the decoded values of the text.
+func tomlEntries(text string, values map[string]interface{}) ([]tomlEntry, error) {
+	data := []byte(text)
+	parser := unstable.Parser{KeepComments: true}
+	parser.Reset(data)
+
+	var entries []tomlEntry
+	// start of the line of every expression, comments included
+	var starts []int
+	// end of the value of each key/value, or the start of its trailing comment
+	var limits []int
+	tables := map[string]int{}
+	section := []string{}
+	for parser.NextExpression() {
+		expr := parser.Expression()
+		if expr.Kind == unstable.Comment {
+			starts = append(starts, lineStart(text, int(expr.Raw.Offset)))
+			continue
+		}
+
+		var keys []string
+		var first, last unstable.Range
+		it := expr.Key()
+		for it.Next() {
+			key := it.Node()
+			if len(keys) == 0 {
+				first = key.Raw
+			}
+			last = key.Raw
+			keys = append(keys, string(key.Data))
+		}
+		entry := tomlEntry{kind: expr.Kind, start: lineStart(text, int(first.Offset))}
+		starts = append(starts, entry.start)
+		key_end := int(last.Offset + last.Length)
+
+		switch expr.Kind {
+		case unstable.KeyValue:
+			entry.path = append(append([]string{}, section...), keys...)
+			entry.value = key_end + strings.IndexByte(text[key_end:], '=') + 1
+			for entry.value < len(text) && (text[entry.value] == ' ' || text[entry.value] == '\t') {
+				entry.value++
+			}
+			limit := -1
+			if comment := expr.Next(); comment != nil && comment.Kind == unstable.Comment {
+				limit = int(comment.Raw.Offset)
+			}
+			if expr.Value().Kind == unstable.Array {
+				items := expr.Value().Children()
+				for items.Next() {
+					if item := items.Node(); item.Kind != unstable.Comment {
+						entry.item, entry.item_end = int(item.Raw.Offset), int(item.Raw.Offset+item.Raw.Length)
+					}
+				}
+			}
+			limits = append(limits, limit)
+		case unstable.Table, unstable.ArrayTable:
+			section = tomlTablePath(keys, expr.Kind == unstable.ArrayTable, values, tables)
+			entry.path = section
+			entry.end = key_end + strings.IndexByte(text[key_end:], ']') + 1
+			entry.line_end = lineEnd(text, entry.end)
+			limits = append(limits, -1)
+		}
+		entries = append(entries, entry)
+	}
+	if err := parser.Error(); err != nil {
+		return nil, err
+	}
+
+	// a value ends where the next expression or its trailing comment starts, without the
+	// whitespace before them
+	next := 0
+	for i := range entries {
+		for starts[next] != entries[i].start {
+			next++
+		}
+		if entries[i].kind != unstable.KeyValue {
+			continue
+		}
+		end := len(text)
+		if next+1 < len(starts) {
+			end = starts[next+1]
+		}
+		if limits[i] >= 0 {
+			end = limits[i]
+		}
+		entries[i].end = entries[i].value + len(strings.TrimRight(text[entries[i].value:end], " \t\r\n"))
+		entries[i].line_end = lineEnd(text, entries[i].end)
+	}
+	return entries, nil
+}
+
+// tomlTablePath returns the path of a table header: keys holding an array of tables stand for
+// its last table so far and an array table header adds a table to its array.
+func tomlTablePath(keys []string, array_table bool, values map[string]interface{}, tables map[string]int) []string {
+	path := []string{}
+	for i, key := range keys {
+		path = append(path, key)
+		if i == len(keys)-1 && array_table {
+			index := tables[tomlKeyPath(path)]
+			tables[tomlKeyPath(path)]++
+			return append(path, strconv.Itoa(index))
+		}
+		if value, _ := tomlLookup(values, path); reflect.TypeOf(value) == reflect.TypeOf([]interface{}{}) {
+			path = append(path, strconv.Itoa(tables[tomlKeyPath(path)]-1))
+		}
+	}
+	return path
+}
+
+// tomlLookup returns the value at a path of keys and indexes.
+func tomlLookup(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = value[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			v = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// tomlEqual compares TOML values the way they are written, dates included.
+func tomlEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(tomlNode(a), tomlNode(b))
+}
+
+// tomlInline writes a value the way it follows a key, tables are written inline.
+func tomlInline(v interface{}) (string, error) {
+	var b bytes.Buffer
+	encoder := toml.NewEncoder(&b)
+	encoder.SetTablesInline(true)
+	if err := encoder.Encode(map[string]interface{}{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(b.String(), "v = "), "\n"), nil
+}
+
+// tomlLines writes a new key with dotted keys for the values of the tables it holds.
+func tomlLines(keys []string, v interface{}) (string, error) {
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		var lines string
+		for _, k := range names {
+			l, err := tomlLines(append(append([]string{}, keys...), k), m[k])
+			if err != nil {
+				return "", err
+			}
+			lines += l
+		}
+		return lines, nil
+	}
+	encoded, err := tomlInline(v)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		if quoted[i] = k; !tomlBareKey.MatchString(k) {
+			if quoted[i], err = tomlInline(k); err != nil {
+				return "", err
+			}
+		}
+	}
+	return strings.Join(quoted, ".") + " = " + encoded + "\n", nil
+}
+
+func tomlKeyPath(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+func lineStart(text string, offset int) int {
+	return strings.LastIndexByte(text[:offset], '\n') + 1
+}
+
+func lineEnd(text string, offset int) int {
+	if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(text)
+}
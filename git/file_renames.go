@@ -0,0 +1,74 @@
+package git
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// fileContents returns the contents of the files in a file set keyed by path.
+func fileContents(files *schema.Set) map[string]string {
+	contents := map[string]string{}
+	for _, v := range files.List() {
+		file := v.(map[string]interface{})
+		contents[file["filepath"].(string)] = file["contents"].(string)
+	}
+	return contents
+}
+
+// movableContents drops the files managing a block or patched in any of the file sets from the
+// contents, only whole files are moved.
+func movableContents(contents map[string]string, files ...*schema.Set) map[string]string {
+	movable := map[string]string{}
+	for filepath, v := range contents {
+		movable[filepath] = v
+	}
+	for _, set := range files {
+		for _, v := range set.List() {
+			file := v.(map[string]interface{})
+			if fileBlock(file) != nil || filePatch(file) != nil {
+				delete(movable, file["filepath"].(string))
+			}
+		}
+	}
+	return movable
+}
+
+// fileRenames pairs the files removed from the old set with the files added to the new set that
+// have the same content, keyed by the old path. Only files that would be deleted on removal are
+// moved, files retained or restored according to on_destroy stay where they are.
+func fileRenames(old_files map[string]string, new_files map[string]string, on_destroy string, original_files map[string]interface{}) map[string]string {
+	var added []string
+	for filepath := range new_files {
+		if _, ok := old_files[filepath]; !ok {
+			added = append(added, filepath)
+		}
+	}
+	sort.Strings(added)
+
+	var removed []string
+	for filepath := range old_files {
+		if _, ok := new_files[filepath]; ok {
+			continue
+		}
+		original, _ := original_files[filepath].(string)
+		if on_destroy == OnDestroyDelete || (on_destroy == OnDestroyRestore && original == "") {
+			removed = append(removed, filepath)
+		}
+	}
+	sort.Strings(removed)
+
+	renames := map[string]string{}
+	moved := map[string]bool{}
+	for _, from := range removed {
+		for _, to := range added {
+			// the old contents may only be known by their hash
+			if !moved[to] && contentsMatch(old_files[from], new_files[to]) {
+				renames[from] = to
+				moved[to] = true
+				break
+			}
+		}
+	}
+	return renames
+}
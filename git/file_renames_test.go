@@ -0,0 +1,69 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileRenames(t *testing.T) {
+	cases := []struct {
+		name       string
+		old_files  map[string]string
+		new_files  map[string]string
+		on_destroy string
+		original   map[string]interface{}
+		expected   map[string]string
+	}{
+		{
+			name:       "moved file",
+			old_files:  map[string]string{"a.txt": "a", "keep.txt": "keep"},
+			new_files:  map[string]string{"dir/a.txt": "a", "keep.txt": "keep"},
+			on_destroy: OnDestroyDelete,
+			expected:   map[string]string{"a.txt": "dir/a.txt"},
+		},
+		{
+			name:       "changed contents",
+			old_files:  map[string]string{"a.txt": "a"},
+			new_files:  map[string]string{"b.txt": "b"},
+			on_destroy: OnDestroyDelete,
+			expected:   map[string]string{},
+		},
+		{
+			name:       "same contents moved twice",
+			old_files:  map[string]string{"a.txt": "x", "b.txt": "x"},
+			new_files:  map[string]string{"c.txt": "x", "d.txt": "x", "e.txt": "x"},
+			on_destroy: OnDestroyDelete,
+			expected:   map[string]string{"a.txt": "c.txt", "b.txt": "d.txt"},
+		},
+		{
+			name:       "copied file",
+			old_files:  map[string]string{"a.txt": "a"},
+			new_files:  map[string]string{"a.txt": "a", "b.txt": "a"},
+			on_destroy: OnDestroyDelete,
+			expected:   map[string]string{},
+		},
+		{
+			name:       "retained file",
+			old_files:  map[string]string{"a.txt": "a"},
+			new_files:  map[string]string{"b.txt": "a"},
+			on_destroy: OnDestroyRetain,
+			expected:   map[string]string{},
+		},
+		{
+			name:       "restored file",
+			old_files:  map[string]string{"a.txt": "a", "b.txt": "b"},
+			new_files:  map[string]string{"c.txt": "a", "d.txt": "b"},
+			on_destroy: OnDestroyRestore,
+			original:   map[string]interface{}{"a.txt": "2e65efe2a145dda7ee51d1741299f848e5bf752e", "b.txt": ""},
+			expected:   map[string]string{"b.txt": "d.txt"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			renames := fileRenames(c.old_files, c.new_files, c.on_destroy, c.original)
+			if !reflect.DeepEqual(renames, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, renames)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type BranchStatus uint8
+
+const (
+	NotExist BranchStatus = 0
+	Exist    BranchStatus = 1
+	Unknown  BranchStatus = 2
+)
+
+const (
+	DryRunBundle = "bundle"
+	DryRunPatch  = "patch"
+)
+
+type GitCommands struct {
+	user         string
+	token        string
+	organization string
+	hostname     string
+}
+
+func NewGitCommands(user string, token string, org string, hostname string) *GitCommands {
+	return &GitCommands{
+		user:         user,
+		token:        token,
+		organization: org,
+		hostname:     hostname,
+	}
+}
+
+func (r *GitCommands) getAuthorString(name string, email string) []string {
+	return []string{"--author", fmt.Sprintf("%s <%s>", name, email)}
+}
+
+func (r *GitCommands) repoUrl(repo string, project string) string {
+	if project != "" {
+		return fmt.Sprintf("https://%s:%s@%s/%s/%s/_git/%s", r.user, r.token, r.hostname, r.organization, project, repo)
+	}
+	return fmt.Sprintf("https://%s:%s@%s/%s/%s", r.user, r.token, r.hostname, r.organization, repo)
+}
+
+// repoName returns the URL of the repository without scheme and credentials, e.g. github.com/org/repo.
+func (r *GitCommands) repoName(repo string, project string) string {
+	if project != "" {
+		return fmt.Sprintf("%s/%s/%s/_git/%s", r.hostname, r.organization, project, repo)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.hostname, r.organization, repo)
+}
+
+// lockKey returns the key writes to the branch of the repository are serialized on, the URL of the
+// repository without credentials followed by the branch.
+func (r *GitCommands) lockKey(repo string, project string, branch string) string {
+	return fmt.Sprintf("https://%s#%s", r.repoName(repo, project), branch)
+}
+
+// commitUrl returns the web URL of a commit in the repository.
+func (r *GitCommands) commitUrl(repo string, project string, sha string) string {
+	if project != "" {
+		return fmt.Sprintf("https://%s/%s/%s/_git/%s/commit/%s", r.hostname, r.organization, project, repo, sha)
+	}
+	if r.hostname == "gitlab.com" {
+		return fmt.Sprintf("https://%s/%s/%s/-/commit/%s", r.hostname, r.organization, repo, sha)
+	}
+	return fmt.Sprintf("https://%s/%s/%s/commit/%s", r.hostname, r.organization, repo, sha)
+}
+
+// cloneBare makes a blobless bare clone of the repository into path. It is meant for read-only
+// queries of the history where no working tree is needed, blobs are fetched lazily by git.
+func (r *GitCommands) cloneBare(ctx context.Context, path string, repo string, project string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	if _, err := gitCommand(ctx, path, "clone", "--bare", "--filter=blob:none", "--quiet", "--", r.repoUrl(repo, project), "."); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resolveRef returns the commit SHA the given ref points to.
+func (r *GitCommands) resolveRef(ctx context.Context, path string, ref string) (string, error) {
+	out, err := gitOutput(ctx, path, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve ref %s: %w", ref, err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// lsTree returns the tree entries of the given paths at rev, keyed by path. Missing paths are
+// left out.
+func (r *GitCommands) lsTree(ctx context.Context, path string, rev string, paths []string) (map[string]TreeEntry, error) {
+	entries := map[string]TreeEntry{}
+	if len(paths) == 0 {
+		return entries, nil
+	}
+	out, err := gitOutput(ctx, path, flatten("-c", "core.quotePath=false", "ls-tree", "-z", "--full-tree", rev, "--", paths)...)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseLsTree(string(out))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range parsed {
+		entries[entry.Path] = entry
+	}
+	return entries, nil
+}
+
+// createBranch creates the branch from base and checks it out. An empty base starts from the
+// default branch, or from no commit at all when the repository is empty.
+func (r *GitCommands) createBranch(ctx context.Context, path string, branch string, base string) (string, error) {
+	if base == "" {
+		if _, err := gitOutput(ctx, path, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+			// empty repository, the first commit starts the branch
+			if _, err := gitCommand(ctx, path, "symbolic-ref", "HEAD", "refs/heads/"+branch); err != nil {
+				return "", err
+			}
+			return "", nil
+		}
+		base = "HEAD"
+	}
+
+	sha, err := r.resolveRef(ctx, path, base)
+	if err != nil {
+		// branches other than the default one are only known as remote branches in a clone
+		var remote_err error
+		if sha, remote_err = r.resolveRef(ctx, path, "origin/"+base); remote_err != nil {
+			return "", err
+		}
+	}
+	if _, err := gitCommand(ctx, path, "checkout", "-b", branch, sha, "--"); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+func (r *GitCommands) checkout(ctx context.Context, path string, repo string, branch string, project string) (string, BranchStatus, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", Unknown, err
+	}
+
+	// May already be checked out from another project
+	if _, err := os.Stat(fmt.Sprintf("%s/.git", path)); err != nil {
+		if _, err := gitCommand(ctx, path, "clone", "--", r.repoUrl(repo, project), "."); err != nil {
+			return "", Unknown, err
+		}
+	}
+
+	if _, err := gitCommand(ctx, path, "checkout", "--guess", branch, "--"); err != nil {
+		return "", NotExist, err
+	}
+
+	var head string
+	if out, err := gitCommand(ctx, path, "rev-parse", "HEAD"); err != nil {
+		return "", NotExist, err
+	} else {
+		head = strings.TrimRight(string(out), "\n")
+	}
+
+	return head, Exist, nil
+}
+
+// remoteContains returns the SHA the branch points to on the remote, empty when the branch doesn't
+// exist, and whether it's sha or a descendant of it.
+func (r *GitCommands) remoteContains(ctx context.Context, path string, branch string, sha string) (string, bool, error) {
+	out, err := gitOutput(ctx, path, "ls-remote", "origin", "refs/heads/"+branch)
+	if err != nil {
+		return "", false, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", false, nil
+	}
+	remote_sha := fields[0]
+	if remote_sha == sha {
+		return remote_sha, true, nil
+	}
+	// the commits on top of sha have to be fetched to tell
+	if _, err := gitOutput(ctx, path, "fetch", "-q", "origin", "refs/heads/"+branch); err != nil {
+		return remote_sha, false, err
+	}
+	if _, err := gitOutput(ctx, path, "merge-base", "--is-ancestor", sha, remote_sha); err != nil {
+		return remote_sha, false, nil
+	}
+	return remote_sha, true, nil
+}
+
+// writeDryRun writes the commits of the branch which aren't on the remote yet into the output
+// directory of the dry run, as a git bundle or a patch series, instead of pushing them. It
+// returns the path written to.
+func (r *GitCommands) writeDryRun(ctx context.Context, path string, repo string, branch string, dry_run DryRun) (string, error) {
+	out, err := gitOutput(ctx, path, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	name := strings.ReplaceAll(fmt.Sprintf("%s_%s_%s_%s", r.organization, repo, branch, strings.TrimRight(string(out), "\n")), "/", "_")
+	output_dir, err := filepath.Abs(dry_run.OutputDir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(output_dir, 0755); err != nil {
+		return "", err
+	}
+	ref := "refs/heads/" + branch
+	if dry_run.Format == DryRunPatch {
+		target := filepath.Join(output_dir, name)
+		if _, err := gitCommand(ctx, path, "format-patch", "--root", "-o", target, ref, "--not", "--remotes=origin"); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+	target := filepath.Join(output_dir, name+".bundle")
+	if _, err := gitCommand(ctx, path, "bundle", "create", target, ref, "--not", "--remotes=origin"); err != nil {
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,198 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDryRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, checkout := path.Join(dir, "remote"), path.Join(dir, "checkout")
+	git := func(cwd string, args ...string) {
+		if _, err := gitCommand(ctx, cwd, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(dir, "init", "-q", "--bare", "-b", "main", remote)
+	git(dir, "clone", "-q", remote, checkout)
+	git(checkout, "checkout", "-q", "-b", "main")
+	git(checkout, "commit", "-q", "--allow-empty", "-m", "pushed")
+	git(checkout, "push", "-q", "origin", "HEAD")
+	git(checkout, "commit", "-q", "--allow-empty", "-m", "first")
+	git(checkout, "commit", "-q", "--allow-empty", "-m", "second")
+
+	commands := NewGitCommands("u", "t", "org", "example.com")
+	target, err := commands.writeDryRun(ctx, checkout, "repo", "main", DryRun{OutputDir: path.Join(dir, "out"), Format: DryRunBundle})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if filepath.Ext(target) != ".bundle" {
+		t.Errorf("expected a bundle, got %s", target)
+	}
+	git(checkout, "bundle", "verify", "-q", target)
+
+	target, err = commands.writeDryRun(ctx, checkout, "repo", "main", DryRun{OutputDir: path.Join(dir, "out"), Format: DryRunPatch})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	patches, err := os.ReadDir(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 {
+		t.Errorf("expected the 2 commits not pushed, got %d patches", len(patches))
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	commands := NewGitCommands("u", "secret", "org", "dev.azure.com")
+	if key := commands.lockKey("repo", "", "main"); key != "https://dev.azure.com/org/repo#main" {
+		t.Errorf("unexpected key %s", key)
+	}
+	if key := commands.lockKey("repo", "proj", "feature/x"); key != "https://dev.azure.com/org/proj/_git/repo#feature/x" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func TestRemoteContains(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, checkout, other := path.Join(dir, "remote"), path.Join(dir, "checkout"), path.Join(dir, "other")
+	git := func(cwd string, args ...string) string {
+		out, err := gitCommand(ctx, cwd, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimRight(string(out), "\n")
+	}
+	git(dir, "init", "-q", "--bare", "-b", "main", remote)
+	git(dir, "clone", "-q", remote, checkout)
+	git(checkout, "checkout", "-q", "-b", "main")
+	git(checkout, "commit", "-q", "--allow-empty", "-m", "pushed")
+	git(checkout, "push", "-q", "origin", "HEAD")
+	pushed := git(checkout, "rev-parse", "HEAD")
+
+	commands := NewGitCommands("u", "t", "org", "example.com")
+	if remote_sha, contains, err := commands.remoteContains(ctx, checkout, "main", pushed); err != nil || !contains || remote_sha != pushed {
+		t.Errorf("expected the pushed commit on the remote, got %s %v %v", remote_sha, contains, err)
+	}
+
+	// someone else pushes on top
+	git(dir, "clone", "-q", remote, other)
+	git(other, "commit", "-q", "--allow-empty", "-m", "on top")
+	git(other, "push", "-q", "origin", "HEAD")
+	if _, contains, err := commands.remoteContains(ctx, checkout, "main", pushed); err != nil || !contains {
+		t.Errorf("expected a descendant to contain the pushed commit, got %v %v", contains, err)
+	}
+
+	git(checkout, "commit", "-q", "--allow-empty", "-m", "not pushed")
+	local := git(checkout, "rev-parse", "HEAD")
+	if remote_sha, contains, err := commands.remoteContains(ctx, checkout, "main", local); err != nil || contains || remote_sha == "" {
+		t.Errorf("expected the remote branch not to contain the local commit, got %s %v %v", remote_sha, contains, err)
+	}
+	if remote_sha, contains, err := commands.remoteContains(ctx, checkout, "missing", local); err != nil || contains || remote_sha != "" {
+		t.Errorf("expected no remote branch, got %s %v %v", remote_sha, contains, err)
+	}
+}
+
+// testRemote creates the bare repository org/repo in a temp dir with a.txt on its main branch, git
+// is configured to fetch and push https://example.com/org/repo from it. It returns the directory of
+// the bare repository and the meta of a provider using it.
+func testRemote(t *testing.T) (string, *Owner) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, seed := path.Join(dir, "org", "repo"), path.Join(dir, "seed")
+	git := func(cwd string, args ...string) {
+		if _, err := gitCommand(ctx, cwd, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(dir, "init", "-q", "--bare", "-b", "main", remote)
+	git(dir, "clone", "-q", remote, seed)
+	if err := os.WriteFile(path.Join(seed, "a.txt"), []byte("hello\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(seed, "add", "-A")
+	git(seed, "commit", "-qm", "init")
+	git(seed, "push", "-q", "origin", "HEAD:main")
+
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url.file://"+dir+"/.insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", "https://u:t@example.com/")
+	return remote, &Owner{name: "u", token: "t", defaultAuthor: Author{Name: "a", Email: "a@x"}, lockDir: path.Join(dir, "locks")}
+}
+
+// testRemoteFile returns the contents of a file on a branch of the bare repository.
+func testRemoteFile(t *testing.T, remote string, branch string, filepath string) string {
+	out, err := gitOutput(context.Background(), remote, "show", branch+":"+filepath)
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+func TestCreateBranch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote, empty, seed := path.Join(dir, "remote"), path.Join(dir, "empty"), path.Join(dir, "seed")
+	git := func(cwd string, args ...string) string {
+		out, err := gitCommand(ctx, cwd, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimRight(string(out), "\n")
+	}
+	git(dir, "init", "-q", "--bare", "-b", "main", remote)
+	git(dir, "init", "-q", "--bare", "-b", "main", empty)
+	git(dir, "clone", "-q", remote, seed)
+	git(seed, "checkout", "-q", "-b", "main")
+	git(seed, "commit", "-q", "--allow-empty", "-m", "main")
+	git(seed, "push", "-q", "origin", "main")
+	main := git(seed, "rev-parse", "HEAD")
+	git(seed, "checkout", "-q", "-b", "release")
+	git(seed, "commit", "-q", "--allow-empty", "-m", "release")
+	git(seed, "push", "-q", "origin", "release")
+	release := git(seed, "rev-parse", "HEAD")
+
+	commands := NewGitCommands("u", "t", "org", "example.com")
+	cases := []struct {
+		remote string
+		base   string
+		sha    string
+		err    bool
+	}{
+		{remote, "", main, false},
+		{remote, "main", main, false},
+		// only known as origin/release in a clone
+		{remote, "release", release, false},
+		{remote, "missing", "", true},
+		{empty, "", "", false},
+	}
+	for i, c := range cases {
+		checkout := path.Join(dir, fmt.Sprintf("checkout%d", i))
+		git(dir, "clone", "-q", c.remote, checkout)
+		sha, err := commands.createBranch(ctx, checkout, "feature", c.base)
+		if c.err {
+			if err == nil {
+				t.Errorf("createBranch(%q): expected an error, got %s", c.base, sha)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("createBranch(%q): unexpected error: %s", c.base, err)
+			continue
+		}
+		if sha != c.sha {
+			t.Errorf("createBranch(%q): expected %q, got %q", c.base, c.sha, sha)
+		}
+		if head := git(checkout, "symbolic-ref", "HEAD"); head != "refs/heads/feature" {
+			t.Errorf("createBranch(%q): expected feature to be checked out, got %s", c.base, head)
+		}
+	}
+}
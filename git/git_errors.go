@@ -0,0 +1,114 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+const (
+	GitErrorAuth           = "auth"
+	GitErrorRepoNotFound   = "repo_not_found"
+	GitErrorBranchNotFound = "branch_not_found"
+	GitErrorRejected       = "rejected"
+	GitErrorNonFastForward = "non_fast_forward"
+	GitErrorWorkflowScope  = "workflow_scope"
+	GitErrorNetwork        = "network"
+)
+
+// GitError is the error of a failed git command, Kind tells what went wrong when the output of git
+// is recognized and is empty otherwise.
+type GitError struct {
+	Kind   string
+	Output string
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// gitErrorPatterns are the messages of git and of the hosts telling each kind of error apart, in
+// the order they are looked for since a rejected push also mentions the rejection reason.
+var gitErrorPatterns = []struct {
+	kind     string
+	patterns []string
+}{
+	{GitErrorWorkflowScope, []string{"without `workflow` scope", "refusing to allow a personal access token to create or update workflow", "refusing to allow an oauth app to create or update workflow"}},
+	{GitErrorNonFastForward, []string{"non-fast-forward", "(fetch first)", "(stale info)", "tip of your current branch is behind"}},
+	{GitErrorRejected, []string{"protected branch", "pre-receive hook declined", "[remote rejected]", "push declined", "gh006", "tf402455", "gitlab: you are not allowed to push"}},
+	{GitErrorAuth, []string{"authentication failed", "could not read username", "could not read password", "invalid username or password", "http basic: access denied", "returned error: 401", "returned error: 403", "terminal prompts disabled", "permission to", "tf401444"}},
+	{GitErrorRepoNotFound, []string{"repository not found", "does not appear to be a git repository", "returned error: 404", "could not be found", "tf401019"}},
+	{GitErrorBranchNotFound, []string{"couldn't find remote ref", "remote ref does not exist", "remote branch", "did not match any file(s) known to git", "invalid reference"}},
+	{GitErrorNetwork, []string{"could not resolve host", "failed to connect", "connection timed out", "connection refused", "operation timed out", "ssl certificate problem", "server certificate verification failed", "gnutls", "ssl_connect", "network is unreachable", "unable to access"}},
+}
+
+// classifyGitError returns the kind of error git reported in its output, or an empty string when
+// it isn't recognized.
+func classifyGitError(output string) string {
+	output = strings.ToLower(output)
+	for _, p := range gitErrorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(output, pattern) {
+				return p.kind
+			}
+		}
+	}
+	return ""
+}
+
+// gitDiagnostics returns the diagnostics of a failed operation, message tells what failed. Errors
+// of git it recognizes get a clear summary, a remediation and the path of the attribute to look at.
+func gitDiagnostics(err error, message string) diag.Diagnostics {
+	var git_err *GitError
+	if !errors.As(err, &git_err) || git_err.Kind == "" {
+		return diag.Errorf("%s: %s", message, err)
+	}
+	var summary, remediation string
+	var attribute cty.Path
+	switch git_err.Kind {
+	case GitErrorAuth:
+		summary = "Git authentication failed"
+		remediation = "Check that the provider `token` is set, hasn't expired and has write access to the repository."
+	case GitErrorRepoNotFound:
+		summary = "Repository not found"
+		remediation = "Check the `hostname`, `organization`, `project` and `repository`. Hosts also answer this way when " +
+			"the token isn't allowed to see the repository."
+		attribute = cty.GetAttrPath("repository")
+	case GitErrorBranchNotFound:
+		summary = "Branch not found"
+		remediation = "Check the `branch`, or set `create_branch = true` to create it from `base_ref`."
+		attribute = cty.GetAttrPath("branch")
+	case GitErrorRejected:
+		summary = "Push rejected by the remote"
+		remediation = "A branch protection rule, policy or server side hook rejected the push. Push to another branch " +
+			"and merge it through a pull request, or allow the token to bypass the rule."
+		attribute = cty.GetAttrPath("branch")
+	case GitErrorNonFastForward:
+		summary = "Branch changed during the apply"
+		remediation = "Someone else pushed to the branch since it was checked out. Run the apply again."
+		attribute = cty.GetAttrPath("branch")
+	case GitErrorWorkflowScope:
+		summary = "Token lacks the workflow scope"
+		remediation = "Files under `.github/workflows` can only be pushed with a token having the `workflow` scope, " +
+			"or the `workflows` permission for a GitHub App."
+		attribute = cty.GetAttrPath("file")
+	case GitErrorNetwork:
+		summary = "Git host unreachable"
+		remediation = "Check the `hostname`, the network and proxy settings and the TLS certificates of the host."
+		attribute = cty.GetAttrPath("hostname")
+	}
+	return diag.Diagnostics{{
+		Severity:      diag.Error,
+		Summary:       summary,
+		Detail:        fmt.Sprintf("%s\n\n%s: %s", remediation, message, strings.TrimSpace(git_err.Output)),
+		AttributePath: attribute,
+	}}
+}
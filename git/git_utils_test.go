@@ -0,0 +1,42 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLsTree(t *testing.T) {
+	out := "100644 blob 8baef1b4abc478178b004d62031cf7fe6db6f903\tREADME.md\x00" +
+		"100755 blob e69de29bb2d1d6434b8b29ae775ad8c2e48c5391\tscripts/run me.sh\x00" +
+		"120000 blob 1de565933b05f74c75ff9a6520af5f9f8a5a2f1d\tlink\x00"
+	expected := []TreeEntry{
+		{Mode: "100644", Type: "blob", Sha: "8baef1b4abc478178b004d62031cf7fe6db6f903", Path: "README.md"},
+		{Mode: "100755", Type: "blob", Sha: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", Path: "scripts/run me.sh"},
+		{Mode: "120000", Type: "blob", Sha: "1de565933b05f74c75ff9a6520af5f9f8a5a2f1d", Path: "link"},
+	}
+
+	actual, err := parseLsTree(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\t%#v", actual, expected)
+	}
+
+	if _, err := parseLsTree("100644 blob README.md\x00"); err == nil {
+		t.Fatal("expected an error for malformed output")
+	}
+}
+
+func TestGitBlobSha(t *testing.T) {
+	cases := map[string]string{
+		"":              "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+		"hello world.":  "a4e1be68d1767b63c890d71a8d54aecbea19855b",
+		"hello world\n": "3b18e512dba79e4c8300dd08aeb37f8e728b8dad",
+	}
+	for contents, expected := range cases {
+		if actual := gitBlobSha(contents); actual != expected {
+			t.Fatalf("bad: %q\n\t%s\n\t%s", contents, actual, expected)
+		}
+	}
+}
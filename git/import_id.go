@@ -0,0 +1,77 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const importIdFormat = "hostname/organization/repository:branch:path1,path2"
+
+// parseImportId parses the ID given to `terraform import`. The repository part is read as
+// `hostname/organization/repository`, or `hostname/organization/project/repository` for AzDO.
+// Organizations with slashes, like the `scm/PROJECT` of Bitbucket server, are supported for any
+// other host.
+func parseImportId(id string) (*ImportId, error) {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("unexpected format of ID (%s), expected %s", id, importIdFormat)
+	}
+
+	repo_parts := strings.Split(parts[0], "/")
+	if len(repo_parts) < 3 {
+		return nil, fmt.Errorf("unexpected format of repository (%s), expected hostname/organization/repository", parts[0])
+	}
+	for _, p := range repo_parts {
+		if p == "" {
+			return nil, fmt.Errorf("unexpected format of repository (%s), expected hostname/organization/repository", parts[0])
+		}
+	}
+
+	result := &ImportId{
+		Hostname:   repo_parts[0],
+		Repository: repo_parts[len(repo_parts)-1],
+		Branch:     parts[1],
+	}
+	owner_parts := repo_parts[1 : len(repo_parts)-1]
+	if isAzureDevOps(result.Hostname) && len(owner_parts) == 2 {
+		result.Organization = owner_parts[0]
+		result.Project = owner_parts[1]
+	} else {
+		result.Organization = strings.Join(owner_parts, "/")
+	}
+
+	for _, p := range strings.Split(parts[2], ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			result.Paths = append(result.Paths, p)
+		}
+	}
+	if len(result.Paths) == 0 {
+		return nil, fmt.Errorf("no paths in ID (%s), expected %s", id, importIdFormat)
+	}
+
+	return result, nil
+}
+
+func isAzureDevOps(hostname string) bool {
+	return hostname == "dev.azure.com" || strings.HasSuffix(hostname, ".visualstudio.com")
+}
+
+// resourceId returns the ID of a git_files resource, `hostname/organization/repository:branch:hash`
+// where hash identifies the managed paths. Resources managing different files in the same branch
+// get different IDs, and the ID doesn't change with new commits in the branch.
+func resourceId(hostname string, org string, project string, repo string, branch string, filepaths []string) string {
+	repository := []string{hostname, org}
+	if project != "" {
+		repository = append(repository, project)
+	}
+	repository = append(repository, repo)
+
+	sorted := append([]string{}, filepaths...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\x00")))
+	return fmt.Sprintf("%s:%s:%s", strings.Join(repository, "/"), branch, hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImportId(t *testing.T) {
+	cases := []struct {
+		id       string
+		expected *ImportId
+	}{
+		{
+			id: "github.com/go-pax/terraform-provider-git:main:README.md,docs/**/*.md",
+			expected: &ImportId{
+				Hostname:     "github.com",
+				Organization: "go-pax",
+				Repository:   "terraform-provider-git",
+				Branch:       "main",
+				Paths:        []string{"README.md", "docs/**/*.md"},
+			},
+		},
+		{
+			id: "dev.azure.com/my-org/my-project/my-repo:feature/x:src/main.cpp",
+			expected: &ImportId{
+				Hostname:     "dev.azure.com",
+				Organization: "my-org",
+				Project:      "my-project",
+				Repository:   "my-repo",
+				Branch:       "feature/x",
+				Paths:        []string{"src/main.cpp"},
+			},
+		},
+		{
+			id: "bitbucket.example.com/scm/PROJ/repo:main:managed_file.txt",
+			expected: &ImportId{
+				Hostname:     "bitbucket.example.com",
+				Organization: "scm/PROJ",
+				Repository:   "repo",
+				Branch:       "main",
+				Paths:        []string{"managed_file.txt"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := parseImportId(c.id)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c.id, err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("bad: %s\n\t%#v\n\t%#v", c.id, actual, c.expected)
+		}
+	}
+
+	for _, id := range []string{
+		"github.com/go-pax/terraform-provider-git",
+		"github.com/go-pax/terraform-provider-git:main",
+		"github.com/go-pax/terraform-provider-git:main:",
+		"github.com/terraform-provider-git:main:README.md",
+		"github.com//terraform-provider-git:main:README.md",
+	} {
+		if _, err := parseImportId(id); err == nil {
+			t.Fatalf("expected an error for %s", id)
+		}
+	}
+}
+
+func TestResourceId(t *testing.T) {
+	id := resourceId("github.com", "go-pax", "", "terraform-provider-git", "main", []string{"b.txt", "a.txt"})
+	if !strings.HasPrefix(id, "github.com/go-pax/terraform-provider-git:main:") {
+		t.Fatalf("unexpected ID %s", id)
+	}
+	if same := resourceId("github.com", "go-pax", "", "terraform-provider-git", "main", []string{"a.txt", "b.txt"}); same != id {
+		t.Fatalf("expected the ID not to depend on the order of paths: %s, %s", id, same)
+	}
+	if other := resourceId("github.com", "go-pax", "", "terraform-provider-git", "main", []string{"a.txt"}); other == id {
+		t.Fatalf("expected different paths to have a different ID: %s", id)
+	}
+
+	azdo := resourceId("dev.azure.com", "org", "project", "repo", "main", []string{"a.txt"})
+	if !strings.HasPrefix(azdo, "dev.azure.com/org/project/repo:main:") {
+		t.Fatalf("unexpected ID %s", azdo)
+	}
+}
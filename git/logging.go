@@ -0,0 +1,154 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// LogSubsystem is the tflog subsystem the provider logs to, its level is set with
+// TF_LOG_PROVIDER_GIT_GIT or otherwise follows TF_LOG_PROVIDER.
+const LogSubsystem = "git"
+
+// Field keys whose values are masked in the logs
+var secretLogFields = []string{"token", "password", "authorization"}
+
+type timingsKey struct{}
+
+// operationTimings adds up how long the git subcommands of an operation took.
+type operationTimings struct {
+	lock     sync.Mutex
+	started  time.Time
+	total    map[string]time.Duration
+	count    map[string]int
+	commands int
+}
+
+// logContext returns ctx with the git subsystem, masking the token wherever it shows up.
+func logContext(ctx context.Context, token string) context.Context {
+	ctx = tflog.NewSubsystem(ctx, LogSubsystem, tflog.WithLevelFromEnv("TF_LOG_PROVIDER_GIT", LogSubsystem))
+	ctx = tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, LogSubsystem, secretLogFields...)
+	if token != "" {
+		ctx = tflog.SubsystemMaskAllFieldValuesStrings(ctx, LogSubsystem, token)
+		ctx = tflog.SubsystemMaskMessageStrings(ctx, LogSubsystem, token)
+	}
+	return ctx
+}
+
+// logOperation returns ctx logging the operation on the branch of the repository to the git
+// subsystem. The returned func logs how long the git commands of the operation took when
+// log_timings is enabled, it must be called once the operation is done.
+func logOperation(ctx context.Context, commands *GitCommands, operation string, repo string, project string, branch string, meta interface{}) (context.Context, func()) {
+	ctx = logContext(ctx, commands.token)
+	ctx = tflog.SubsystemSetField(ctx, LogSubsystem, "operation", operation)
+	ctx = tflog.SubsystemSetField(ctx, LogSubsystem, "repo", commands.repoName(repo, project))
+	if branch != "" {
+		ctx = tflog.SubsystemSetField(ctx, LogSubsystem, "branch", branch)
+	}
+	if !meta.(*Owner).logTimings {
+		return ctx, func() {}
+	}
+
+	timings := &operationTimings{
+		started: time.Now(),
+		total:   map[string]time.Duration{},
+		count:   map[string]int{},
+	}
+	ctx = context.WithValue(ctx, timingsKey{}, timings)
+	return ctx, func() {
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Timing of %s: %s", operation, timings), timings.fields())
+	}
+}
+
+// recordTiming adds the duration of a git subcommand to the timings of the operation, if any.
+func recordTiming(ctx context.Context, subcommand string, duration time.Duration) {
+	timings, ok := ctx.Value(timingsKey{}).(*operationTimings)
+	if !ok {
+		return
+	}
+	timings.lock.Lock()
+	defer timings.lock.Unlock()
+	timings.total[subcommand] += duration
+	timings.count[subcommand]++
+	if subcommand != "lock" {
+		timings.commands++
+	}
+}
+
+func (t *operationTimings) fields() map[string]interface{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var git time.Duration
+	for subcommand, duration := range t.total {
+		if subcommand != "lock" {
+			git += duration
+		}
+	}
+	return map[string]interface{}{
+		"duration_ms":     time.Since(t.started).Milliseconds(),
+		"git_duration_ms": git.Milliseconds(),
+		"git_commands":    t.commands,
+		"lock_wait_ms":    t.total["lock"].Milliseconds(),
+	}
+}
+
+// String lists the subcommands slowest first, e.g. "fetch 1.2s (2), checkout 80ms (1)".
+func (t *operationTimings) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	subcommands := make([]string, 0, len(t.total))
+	for subcommand := range t.total {
+		subcommands = append(subcommands, subcommand)
+	}
+	sort.Slice(subcommands, func(i, j int) bool {
+		if t.total[subcommands[i]] != t.total[subcommands[j]] {
+			return t.total[subcommands[i]] > t.total[subcommands[j]]
+		}
+		return subcommands[i] < subcommands[j]
+	})
+	parts := make([]string, 0, len(subcommands))
+	for _, subcommand := range subcommands {
+		parts = append(parts, fmt.Sprintf("%s %s (%d)", subcommand, t.total[subcommand].Round(time.Millisecond), t.count[subcommand]))
+	}
+	if len(parts) == 0 {
+		return "no git commands"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// gitSubcommand returns the subcommand of the git arguments, skipping the global options.
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" || args[i] == "-C":
+			i++
+		case strings.HasPrefix(args[i], "-"):
+		default:
+			return args[i]
+		}
+	}
+	return ""
+}
+
+// logGitCommand logs a finished git command with its duration and exit code.
+func logGitCommand(ctx context.Context, cwd string, args []string, duration time.Duration, exit_code int) {
+	subcommand := gitSubcommand(args)
+	recordTiming(ctx, subcommand, duration)
+	fields := map[string]interface{}{
+		"git_subcommand": subcommand,
+		"args":           strings.Join(args, " "),
+		"working_dir":    cwd,
+		"duration_ms":    duration.Milliseconds(),
+		"exit_code":      exit_code,
+	}
+	message := fmt.Sprintf("git %s", subcommand)
+	if exit_code != 0 {
+		message += " failed"
+	}
+	tflog.SubsystemDebug(ctx, LogSubsystem, message, fields)
+}
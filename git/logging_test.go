@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGitSubcommand(t *testing.T) {
+	cases := map[string][]string{
+		"push":    {"push", "origin", "main"},
+		"ls-tree": {"-c", "core.quotePath=false", "ls-tree", "-z", "HEAD"},
+		"status":  {"-C", "/tmp/checkout", "--no-pager", "status"},
+		"":        {"--version"},
+	}
+	for expected, args := range cases {
+		if actual := gitSubcommand(args); actual != expected {
+			t.Errorf("gitSubcommand(%q) = %q, expected %q", args, actual, expected)
+		}
+	}
+}
+
+func TestOperationTimings(t *testing.T) {
+	// without log_timings nothing is recorded
+	recordTiming(context.Background(), "fetch", time.Second)
+
+	timings := &operationTimings{
+		started: time.Now(),
+		total:   map[string]time.Duration{},
+		count:   map[string]int{},
+	}
+	if actual := timings.String(); actual != "no git commands" {
+		t.Errorf("expected no git commands, got %q", actual)
+	}
+
+	ctx := context.WithValue(context.Background(), timingsKey{}, timings)
+	recordTiming(ctx, "checkout", 80*time.Millisecond)
+	recordTiming(ctx, "fetch", 700*time.Millisecond)
+	recordTiming(ctx, "fetch", 500*time.Millisecond)
+	recordTiming(ctx, "lock", 2*time.Second)
+
+	expected := "lock 2s (1), fetch 1.2s (2), checkout 80ms (1)"
+	if actual := timings.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	fields := timings.fields()
+	if fields["git_commands"] != 3 {
+		t.Errorf("expected 3 git commands, got %v", fields["git_commands"])
+	}
+	if fields["git_duration_ms"] != int64(1280) {
+		t.Errorf("expected 1280ms in git, got %v", fields["git_duration_ms"])
+	}
+	if fields["lock_wait_ms"] != int64(2000) {
+		t.Errorf("expected 2000ms waiting for the lock, got %v", fields["lock_wait_ms"])
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	ctx := context.Background()
+	if _, err := gitOutput(ctx, "", "no-such-subcommand"); exitCode(err) <= 0 {
+		t.Errorf("expected git to exit with an error code, got %d (%v)", exitCode(err), err)
+	}
+	if _, err := gitOutput(ctx, "", "--version"); exitCode(err) != 0 {
+		t.Errorf("expected git --version to succeed, got %d (%v)", exitCode(err), err)
+	}
+}
@@ -1,6 +1,96 @@
 package git
 
+import "time"
+
 type File struct {
 	Contents string `json:"contents"`
 	FilePath string `json:"filepath"`
 }
+
+type Commit struct {
+	Sha         string   `json:"sha"`
+	Subject     string   `json:"subject"`
+	Message     string   `json:"message"`
+	AuthorName  string   `json:"author_name"`
+	AuthorEmail string   `json:"author_email"`
+	Date        string   `json:"date"`
+	Paths       []string `json:"paths"`
+}
+
+type ConventionalCommit struct {
+	Type        string `json:"type"`
+	Scope       string `json:"scope"`
+	Breaking    bool   `json:"breaking"`
+	Description string `json:"description"`
+}
+
+type FileChange struct {
+	Status     string `json:"status"`
+	Path       string `json:"path"`
+	OldPath    string `json:"old_path"`
+	Similarity int    `json:"similarity"`
+	Patch      string `json:"patch"`
+}
+
+type ImportId struct {
+	Hostname     string
+	Organization string
+	Project      string
+	Repository   string
+	Branch       string
+	Paths        []string
+}
+
+type TreeEntry struct {
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+	Path string `json:"path"`
+}
+
+type FileFormat struct {
+	LineEndings           string
+	EnsureTrailingNewline bool
+	Encoding              string
+}
+
+type BlockMarkers struct {
+	Begin string
+	End   string
+}
+
+type FilePatch struct {
+	Format string
+	Set    []PatchOperation
+	Delete []string
+}
+
+type PatchOperation struct {
+	Path  string
+	Value string
+}
+
+type DryRun struct {
+	OutputDir string
+	Format    string
+}
+
+type PrePushCheck struct {
+	Command     string
+	Interpreter []string
+	WorkingDir  string
+	Env         map[string]string
+	Timeout     time.Duration
+}
+
+type SkipCi struct {
+	Marker      string
+	Trailers    []string
+	PushOptions []string
+}
+
+type Author struct {
+	Name    string
+	Email   string
+	Message string
+}
@@ -0,0 +1,195 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"golang.org/x/text/unicode/norm"
+)
+
+// checkFilePath returns an error when the path isn't a clean path relative to the repository
+// root, escapes it or points into the .git dir.
+func checkFilePath(filepath string) error {
+	if filepath == "" {
+		return fmt.Errorf("path is empty")
+	}
+	if path.IsAbs(filepath) || strings.HasPrefix(filepath, "\\") {
+		return fmt.Errorf("path %s must be relative to the repository root", filepath)
+	}
+	if clean := path.Clean(filepath); clean != filepath {
+		return fmt.Errorf("path %s must be clean, use %s instead", filepath, clean)
+	}
+	if filepath == ".." || strings.HasPrefix(filepath, "../") {
+		return fmt.Errorf("path %s escapes the repository root", filepath)
+	}
+	// backslashes separate directories on Windows runners
+	for _, part := range strings.FieldsFunc(filepath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if isDotGit(part) {
+			return fmt.Errorf("path %s points into the .git dir", filepath)
+		}
+	}
+	return nil
+}
+
+// isDotGit tells whether the path component names the .git dir, also through the aliases NTFS
+// resolves to it the way git's verify_path rejects them: trailing dots and spaces, an alternate
+// data stream such as .git::$INDEX_ALLOCATION, and the git~1 short name.
+func isDotGit(part string) bool {
+	if i := strings.IndexByte(part, ':'); i >= 0 {
+		part = part[:i]
+	}
+	part = strings.TrimRight(part, ". ")
+	return strings.EqualFold(part, ".git") || strings.EqualFold(part, "git~1")
+}
+
+// validateFilePath is the schema level validation of a single file path.
+func validateFilePath(i interface{}, p cty.Path) diag.Diagnostics {
+	filepath, ok := i.(string)
+	if !ok {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Expected a string",
+			AttributePath: p,
+		}}
+	}
+	if err := checkFilePath(filepath); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid file path",
+			Detail:        err.Error(),
+			AttributePath: p,
+		}}
+	}
+	if !norm.NFC.IsNormalString(filepath) {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "File path is not NFC normalized",
+			Detail: fmt.Sprintf("The path %s is not NFC normalized, macOS and git may report it as a different path "+
+				"than configured. Use %s instead.", filepath, norm.NFC.String(filepath)),
+			AttributePath: p,
+		}}
+	}
+	return nil
+}
+
+// validateFilePaths validates the paths managed by one resource together: duplicates and paths
+// outside of the allowed prefixes are errors, paths only differing in case are warnings since
+// they collide on case-insensitive filesystems.
+func validateFilePaths(filepaths []string, allowed_prefixes []string) diag.Diagnostics {
+	var diags diag.Diagnostics
+	attribute_path := cty.GetAttrPath("file")
+
+	seen := map[string]bool{}
+	folded := map[string][]string{}
+	for _, filepath := range filepaths {
+		if err := checkFilePath(filepath); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid file path",
+				Detail:        err.Error(),
+				AttributePath: attribute_path,
+			})
+			continue
+		}
+		if seen[filepath] {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Duplicate file path",
+				Detail:        fmt.Sprintf("The path %s is used by more than one file.", filepath),
+				AttributePath: attribute_path,
+			})
+			continue
+		}
+		seen[filepath] = true
+		key := strings.ToLower(norm.NFC.String(filepath))
+		folded[key] = append(folded[key], filepath)
+
+		if len(allowed_prefixes) > 0 && !hasPathPrefix(filepath, allowed_prefixes) {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "File path not allowed",
+				Detail: fmt.Sprintf("The path %s is outside of the prefixes the provider allows: %s", filepath,
+					strings.Join(allowed_prefixes, ", ")),
+				AttributePath: attribute_path,
+			})
+		}
+	}
+
+	var keys []string
+	for key := range folded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if collisions := folded[key]; len(collisions) > 1 {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "File paths collide on case-insensitive filesystems",
+				Detail: fmt.Sprintf("The paths %s only differ in case, checkouts on case-insensitive filesystems "+
+					"can only hold one of them.", strings.Join(collisions, ", ")),
+				AttributePath: attribute_path,
+			})
+		}
+	}
+
+	return diags
+}
+
+// hasPathPrefix returns true when the path is one of the prefixes or inside of one of them.
+func hasPathPrefix(filepath string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || prefix == "." || filepath == prefix || strings.HasPrefix(filepath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCheckoutPath makes sure a file written to or removed from the checkout stays inside of it,
+// directories committed to the repository as symlinks could point anywhere.
+func checkCheckoutPath(checkout_dir string, file string) error {
+	root, err := filepath.EvalSymlinks(checkout_dir)
+	if err != nil {
+		return err
+	}
+
+	// the file itself is replaced when it's a symlink, only its parent dirs must stay inside
+	current := root
+	for _, part := range strings.Split(path.Dir(file), "/") {
+		if part == "." {
+			break
+		}
+		next := filepath.Join(current, part)
+		fi, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			// created as regular dirs on write
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			resolved, err := filepath.EvalSymlinks(next)
+			if err != nil {
+				return fmt.Errorf("path %s goes through the broken symlink %s", file, part)
+			}
+			rel, err := filepath.Rel(root, resolved)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("path %s resolves outside of the repository through the symlink %s", file, part)
+			}
+			if err := checkFilePath(filepath.ToSlash(rel)); err != nil && rel != "." {
+				return fmt.Errorf("path %s resolves to %s through the symlink %s: %w", file, rel, part, err)
+			}
+			next = resolved
+		}
+		current = next
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+func TestCheckFilePath(t *testing.T) {
+	valid := []string{
+		"README.md",
+		"files/go/here/helloworld.txt",
+		".github/workflows/ci.yml",
+		".gitignore",
+		"docs/..md",
+		".git~1",
+		"git~10/x",
+		".gitx/y",
+	}
+	for _, p := range valid {
+		if err := checkFilePath(p); err != nil {
+			t.Fatalf("unexpected error for %s: %s", p, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/etc/passwd",
+		"../../etc/x",
+		"..",
+		"files/../../x",
+		"./README.md",
+		"files//x",
+		"files/",
+		".git/hooks/pre-commit",
+		"sub/.GIT/config",
+		".git./config",
+		".git /config",
+		".Git. . /hooks/post-checkout",
+		"GIT~1/config",
+		"sub/git~1",
+		".git::$INDEX_ALLOCATION/config",
+		"sub\\.git\\config",
+	}
+	for _, p := range invalid {
+		if err := checkFilePath(p); err == nil {
+			t.Fatalf("expected an error for %s", p)
+		}
+	}
+}
+
+func TestValidateFilePath(t *testing.T) {
+	p := cty.GetAttrPath("filepath")
+	if diags := validateFilePath("caf\u00e9.txt", p); len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	diags := validateFilePath("cafe\u0301.txt", p)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Fatalf("expected a warning for a path which is not NFC normalized, got %#v", diags)
+	}
+	diags = validateFilePath("../x", p)
+	if len(diags) != 1 || diags[0].Severity != diag.Error {
+		t.Fatalf("expected an error for an escaping path, got %#v", diags)
+	}
+}
+
+func TestValidateFilePaths(t *testing.T) {
+	diags := validateFilePaths([]string{"a.txt", "A.txt", "b/c.txt"}, nil)
+	if diags.HasError() || len(diags) != 1 || !strings.Contains(diags[0].Detail, "a.txt, A.txt") {
+		t.Fatalf("expected a warning about colliding paths, got %#v", diags)
+	}
+
+	diags = validateFilePaths([]string{"a.txt", "a.txt"}, nil)
+	if !diags.HasError() || diags[0].Summary != "Duplicate file path" {
+		t.Fatalf("expected an error about duplicate paths, got %#v", diags)
+	}
+
+	allowed := []string{"config/generated/", "README.md"}
+	if diags := validateFilePaths([]string{"config/generated/a.yml", "README.md"}, allowed); len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	for _, p := range []string{"config/generated.yml", "config/a.yml", "README.md.bak"} {
+		if diags := validateFilePaths([]string{p}, allowed); !diags.HasError() {
+			t.Fatalf("expected an error for %s outside of the allowed prefixes", p)
+		}
+	}
+}
+
+func TestCheckCheckoutPath(t *testing.T) {
+	checkout_dir := t.TempDir()
+	outside_dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(checkout_dir, "docs", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(checkout_dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"inside":  filepath.Join(checkout_dir, "docs"),
+		"outside": outside_dir,
+		"hooks":   filepath.Join(checkout_dir, ".git"),
+		"broken":  filepath.Join(checkout_dir, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(checkout_dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []string{"a.txt", "docs/sub/a.txt", "new/dir/a.txt", "inside/sub/a.txt", "outside"} {
+		if err := checkCheckoutPath(checkout_dir, p); err != nil {
+			t.Fatalf("unexpected error for %s: %s", p, err)
+		}
+	}
+	for _, p := range []string{"outside/a.txt", "hooks/pre-commit", "broken/a.txt"} {
+		if err := checkCheckoutPath(checkout_dir, p); err == nil {
+			t.Fatalf("expected an error for %s", p)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Most bytes of the diff of a file shown in planned_diff
+const plannedDiffLimit = 4096
+
+// setPlannedDiff sets planned_diff to the unified diff of the planned file changes, or marks it
+// computed when the repository or the files aren't known yet.
+func setPlannedDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	for _, k := range []string{"hostname", "organization", "project", "repository", "branch", "file"} {
+		if !d.NewValueKnown(k) {
+			return d.SetNewComputed("planned_diff")
+		}
+	}
+	planned_diff, err := plannedDiff(ctx, d, meta)
+	if err != nil {
+		return fmt.Errorf("failed to compute the planned diff: %s", err)
+	}
+	return d.SetNew("planned_diff", planned_diff)
+}
+
+// plannedDiff checks the branch out, stages the planned changes of the managed files the way an
+// apply would and returns what plannedFileDiff shows of every changed path, keyed by path.
+func plannedDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) (map[string]interface{}, error) {
+	hostname := d.Get("hostname").(string)
+	org := d.Get("organization").(string)
+	branch := d.Get("branch").(string)
+	repo := d.Get("repository").(string)
+	azdoProject := d.Get("project").(string)
+
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, "plan", repo, azdoProject, branch, meta)
+	defer done()
+	unlock, err := lockBranch(ctx, commands, repo, azdoProject, branch, meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock branch %s: %s", branch, err)
+	}
+	defer unlock()
+
+	checkout_dir, _, status, release, err := meta.(*Owner).checkouts.checkout(ctx, commands, repo, branch, azdoProject)
+	defer release()
+	base_sha := "HEAD"
+	switch status {
+	case NotExist:
+		if !d.Get("create_branch").(bool) {
+			// applying fails or recreates the resource, there is nothing to compare with
+			return map[string]interface{}{}, nil
+		}
+		if base_sha, err = commands.createBranch(ctx, checkout_dir, branch, d.Get("base_ref").(string)); err != nil {
+			return nil, fmt.Errorf("failed to create branch %s: %w", branch, err)
+		}
+	case Unknown:
+		if err != nil {
+			return nil, fmt.Errorf("failed to checkout branch %s of %s: %w", branch, repo, err)
+		}
+	}
+
+	files := plannedFiles(d)
+	filepaths := filePaths(files)
+	if diags := validateCheckout(checkout_dir, filepaths, meta); diags.HasError() {
+		return nil, fmt.Errorf("%s: %s", diags[0].Summary, diags[0].Detail)
+	}
+	config_contents := rawConfigContents(files, d.GetRawConfig())
+	entries := map[string]TreeEntry{}
+	if base_sha != "" {
+		// a branch created in an empty repository has no commit to list yet
+		if entries, err = commands.lsTree(ctx, checkout_dir, "HEAD", filepaths); err != nil {
+			return nil, fmt.Errorf("failed to list files in branch %s: %s", branch, err)
+		}
+	}
+
+	if d.Id() != "" {
+		old_files, _ := d.GetChange("file")
+		original_files, _ := d.GetChange("original_files")
+		original_values, _ := d.GetChange("original_values")
+		if _, _, err := releaseFiles(ctx, checkout_dir, old_files.(*schema.Set), files, config_contents, d.Get("on_destroy").(string),
+			original_files.(map[string]interface{}), original_values.(map[string]interface{}), meta.(*Owner).fileFormat); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := writeFiles(ctx, checkout_dir, files, config_contents, entries, meta.(*Owner).fileFormat); err != nil {
+		return nil, err
+	}
+
+	changes, err := stagedChanges(ctx, checkout_dir)
+	if err != nil {
+		return nil, err
+	}
+	old_files, _ := d.GetChange("file")
+	modes := contentsModes(old_files.(*schema.Set), files)
+	planned_diff := map[string]interface{}{}
+	for _, change := range changes {
+		diff := plannedFileDiff(change, modes)
+		planned_diff[change.Path] = diff
+		tflog.SubsystemDebug(ctx, LogSubsystem, fmt.Sprintf("Planned change of %s in branch %s", change.Path, branch), map[string]interface{}{"status": change.Status})
+	}
+	return planned_diff, nil
+}
+
+// contentsModes returns the contents_in_state of every file of the sets, a file only hashed in
+// one of them is taken as hashed.
+func contentsModes(sets ...*schema.Set) map[string]string {
+	modes := map[string]string{}
+	for _, files := range sets {
+		for _, v := range files.List() {
+			file := v.(map[string]interface{})
+			mode, _ := file["contents_in_state"].(string)
+			if mode == "" {
+				mode = ContentsFull
+			}
+			if modes[file["filepath"].(string)] == "" || mode != ContentsFull {
+				modes[file["filepath"].(string)] = mode
+			}
+		}
+	}
+	return modes
+}
+
+// plannedFileDiff returns what planned_diff shows of a change: a summary when the contents of
+// the file are only hashed in the state, otherwise its diff cut after plannedDiffLimit bytes.
+func plannedFileDiff(change FileChange, modes map[string]string) string {
+	for _, filepath := range []string{change.Path, change.OldPath} {
+		if mode := modes[filepath]; mode != "" && mode != ContentsFull {
+			return diffSummary(change, mode)
+		}
+	}
+	if len(change.Patch) <= plannedDiffLimit {
+		return change.Patch
+	}
+	cut := strings.LastIndexByte(change.Patch[:plannedDiffLimit], '\n')
+	if cut < 0 {
+		cut = plannedDiffLimit
+	}
+	return fmt.Sprintf("%s\n[diff truncated, %d of %d bytes not shown]", change.Patch[:cut], len(change.Patch)-cut, len(change.Patch))
+}
+
+// diffSummary describes a change with the number of added and removed lines of its diff.
+func diffSummary(change FileChange, mode string) string {
+	added, removed := 0, 0
+	hunks := false
+	for _, line := range strings.Split(change.Patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			hunks = true
+		case hunks && strings.HasPrefix(line, "+"):
+			added++
+		case hunks && strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	status := change.Status
+	if change.Status == ChangeRenamed {
+		status = fmt.Sprintf("renamed from %s", change.OldPath)
+	}
+	return fmt.Sprintf("%s, +%d -%d lines, the diff isn't shown since contents_in_state is %s", status, added, removed, mode)
+}
+
+// stagedChanges returns the changes staged in the checkout with the unified diff of each file.
+func stagedChanges(ctx context.Context, checkout_dir string) ([]FileChange, error) {
+	out, err := gitOutput(ctx, checkout_dir, "-c", "core.quotePath=false", "diff", "--cached", "--name-status", "-z", "--find-renames")
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff staged files: %s", err)
+	}
+	changes, err := parseDiffNameStatus(string(out))
+	if err != nil {
+		return nil, err
+	}
+	for i, change := range changes {
+		change_paths := []string{change.Path}
+		if change.OldPath != "" {
+			change_paths = append(change_paths, change.OldPath)
+		}
+		out, err := gitOutput(ctx, checkout_dir, flatten("diff", "--cached", "--find-renames", "--no-color", "--no-ext-diff", "--", change_paths)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff %s: %s", change.Path, err)
+		}
+		changes[i].Patch = strings.TrimSuffix(string(out), "\n")
+	}
+	return changes, nil
+}
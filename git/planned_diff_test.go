@@ -0,0 +1,115 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestStagedChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(filepath string, contents string) {
+		if err := os.WriteFile(path.Join(dir, filepath), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		if _, err := gitCommand(ctx, dir, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("a.txt", "hello\n")
+	write("b.txt", "moved\n")
+	write("c.txt", "deleted\n")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+
+	write("a.txt", "hello\nworld\n")
+	git("mv", "b.txt", "d.txt")
+	git("rm", "-q", "c.txt")
+	git("add", "-A")
+
+	changes, err := stagedChanges(ctx, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{
+		"a.txt": "+world",
+		"c.txt": "-deleted",
+		"d.txt": "rename from b.txt",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for _, change := range changes {
+		if !strings.Contains(change.Patch, expected[change.Path]) {
+			t.Errorf("expected the diff of %s to contain %q, got %q", change.Path, expected[change.Path], change.Patch)
+		}
+	}
+}
+
+func TestPlannedFileDiff(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(filepath string, contents string) {
+		if err := os.WriteFile(path.Join(dir, filepath), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		if _, err := gitCommand(ctx, dir, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("secret.env", "TOKEN=old-secret\n")
+	write("moved.env", "KEY=moved-secret\n")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+
+	write("secret.env", "TOKEN=new-secret\n")
+	git("mv", "moved.env", "renamed.env")
+	write("big.txt", strings.Repeat("a line of a big file\n", 1000))
+	git("add", "-A")
+	changes, err := stagedChanges(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+		"repository": "repo",
+		"branch":     "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "secret.env", "contents": "TOKEN=new-secret\n", "contents_in_state": ContentsSha256},
+			map[string]interface{}{"filepath": "moved.env", "contents": "KEY=moved-secret\n", "contents_in_state": ContentsGitBlobSha},
+			map[string]interface{}{"filepath": "big.txt", "contents": strings.Repeat("a line of a big file\n", 1000)},
+		},
+	})
+	modes := contentsModes(d.Get("file").(*schema.Set))
+	diffs := map[string]string{}
+	for _, change := range changes {
+		diffs[change.Path] = plannedFileDiff(change, modes)
+	}
+
+	for filepath, diff := range diffs {
+		if strings.Contains(diff, "secret") {
+			t.Errorf("expected the diff of %s not to show hashed contents, got %q", filepath, diff)
+		}
+	}
+	expected := "modified, +1 -1 lines, the diff isn't shown since contents_in_state is sha256"
+	if diffs["secret.env"] != expected {
+		t.Errorf("expected %q, got %q", expected, diffs["secret.env"])
+	}
+	if !strings.HasPrefix(diffs["renamed.env"], "renamed from moved.env, ") {
+		t.Errorf("expected a summary of the rename, got %q", diffs["renamed.env"])
+	}
+	if len(diffs["big.txt"]) > plannedDiffLimit+100 || !strings.Contains(diffs["big.txt"], "[diff truncated, ") {
+		t.Errorf("expected the diff of big.txt to be truncated, got %d bytes", len(diffs["big.txt"]))
+	}
+}
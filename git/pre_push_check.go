@@ -0,0 +1,107 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// How long the output pipes of a timed out check are waited for once it's killed, commands it
+// started in the background could keep them open forever
+const prePushCheckWaitDelay = 5 * time.Second
+
+// prePushChecks returns the pre_push_check blocks of the resource.
+func prePushChecks(d *schema.ResourceData) []PrePushCheck {
+	var checks []PrePushCheck
+	for _, v := range d.Get("pre_push_check").([]interface{}) {
+		block := v.(map[string]interface{})
+		check := PrePushCheck{
+			Command:    block["command"].(string),
+			WorkingDir: block["working_dir"].(string),
+			Env:        map[string]string{},
+		}
+		for _, s := range block["interpreter"].([]interface{}) {
+			check.Interpreter = append(check.Interpreter, s.(string))
+		}
+		if len(check.Interpreter) == 0 {
+			check.Interpreter = defaultInterpreter()
+		}
+		for k, s := range block["env"].(map[string]interface{}) {
+			check.Env[k] = s.(string)
+		}
+		// the duration is validated by the schema
+		check.Timeout, _ = time.ParseDuration(block["timeout"].(string))
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// defaultInterpreter returns the shell commands run with when no interpreter is configured.
+func defaultInterpreter() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C"}
+	}
+	return []string{"/bin/sh", "-c"}
+}
+
+// runPrePushChecks runs the pre_push_check commands in the checkout, where the changes are staged
+// but not committed yet. The first failing command stops the apply with its output.
+func runPrePushChecks(ctx context.Context, checkout_dir string, d *schema.ResourceData) diag.Diagnostics {
+	for _, check := range prePushChecks(d) {
+		out, err := runPrePushCheck(ctx, checkout_dir, check)
+		if err != nil {
+			return diag.Diagnostics{{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("Pre-push check failed: %s", check.Command),
+				Detail:   fmt.Sprintf("The check %q in %s %s, nothing was pushed:\n%s", check.Command, check.WorkingDir, err, out),
+			}}
+		}
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Pre-push check passed: %s", check.Command))
+	}
+	return nil
+}
+
+// runPrePushCheck runs a single check and returns its combined output.
+func runPrePushCheck(ctx context.Context, checkout_dir string, check PrePushCheck) (string, error) {
+	// the dir itself must stay inside the checkout, like the parent dirs of a file
+	if err := checkCheckoutPath(checkout_dir, check.WorkingDir+"/."); err != nil {
+		return "", err
+	}
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+	command := exec.CommandContext(ctx, check.Interpreter[0], append(check.Interpreter[1:], check.Command)...)
+	command.Dir = filepath.Join(checkout_dir, filepath.FromSlash(check.WorkingDir))
+	command.Env = os.Environ()
+	var keys []string
+	for k := range check.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		command.Env = append(command.Env, fmt.Sprintf("%s=%s", k, check.Env[k]))
+	}
+	command.WaitDelay = prePushCheckWaitDelay
+	out, err := command.CombinedOutput()
+	output := strings.TrimRight(string(out), "\n")
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("timed out after %s", check.Timeout)
+	}
+	if err != nil {
+		return output, fmt.Errorf("failed: %s", err)
+	}
+	return output, nil
+}
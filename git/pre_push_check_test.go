@@ -0,0 +1,51 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunPrePushCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the checks are shell commands")
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(path.Join(dir, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, "conf", "app.yml"), []byte("a: 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), path.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		check  PrePushCheck
+		output string
+		failed bool
+	}{
+		{PrePushCheck{Command: "cat app.yml", WorkingDir: "conf"}, "a: 1", false},
+		{PrePushCheck{Command: `echo "$LEVEL"; exit 3`, WorkingDir: ".", Env: map[string]string{"LEVEL": "strict"}}, "strict", true},
+		{PrePushCheck{Command: "print(1)", Interpreter: []string{"/bin/sh", "-c", `echo "$1"`, "sh"}, WorkingDir: "."}, "print(1)", false},
+		{PrePushCheck{Command: "exec sleep 5", WorkingDir: ".", Timeout: 100 * time.Millisecond}, "", true},
+		{PrePushCheck{Command: "true", WorkingDir: "out"}, "", true},
+	}
+	for _, c := range cases {
+		if len(c.check.Interpreter) == 0 {
+			c.check.Interpreter = defaultInterpreter()
+		}
+		output, err := runPrePushCheck(context.Background(), dir, c.check)
+		if (err != nil) != c.failed {
+			t.Errorf("runPrePushCheck(%q): expected failed %v, got %v", c.check.Command, c.failed, err)
+		}
+		if !strings.Contains(output, c.output) {
+			t.Errorf("runPrePushCheck(%q): expected output %q, got %q", c.check.Command, c.output, output)
+		}
+	}
+}
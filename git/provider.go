@@ -2,8 +2,10 @@ package git
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -37,11 +39,117 @@ func Provider() *schema.Provider {
 				Default:     false,
 				Description: descriptions["insecure"],
 			},
+			"allowed_path_prefixes": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: descriptions["allowed_path_prefixes"],
+			},
+			"line_endings": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          LineEndingsPreserve,
+				ValidateDiagFunc: validateStringInSlice([]string{LineEndingsPreserve, LineEndingsLf, LineEndingsCrlf}),
+				Description:      descriptions["line_endings"],
+			},
+			"ensure_trailing_newline": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["ensure_trailing_newline"],
+			},
+			"encoding": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          EncodingUtf8,
+				ValidateDiagFunc: validateStringInSlice([]string{EncodingUtf8, EncodingUtf8Bom, EncodingUtf16le}),
+				Description:      descriptions["encoding"],
+			},
+			"dry_run": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GIT_PROVIDER_DRY_RUN", false),
+				Description: descriptions["dry_run"],
+			},
+			"dry_run_output_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GIT_PROVIDER_DRY_RUN_OUTPUT_DIR", "git-dry-run"),
+				Description: descriptions["dry_run_output_dir"],
+			},
+			"dry_run_format": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          DryRunBundle,
+				ValidateDiagFunc: validateStringInSlice([]string{DryRunBundle, DryRunPatch}),
+				Description:      descriptions["dry_run_format"],
+			},
+			"lock_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GIT_PROVIDER_LOCK_DIR", ""),
+				Description: descriptions["lock_dir"],
+			},
+			"lock_timeout": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "10m",
+				ValidateDiagFunc: validateDuration,
+				Description:      descriptions["lock_timeout"],
+			},
+			"push_verify_retries": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Default:          0,
+				ValidateDiagFunc: validateIntAtLeast(0),
+				Description:      descriptions["push_verify_retries"],
+			},
+			"push_verify_delay": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "5s",
+				ValidateDiagFunc: validateDuration,
+				Description:      descriptions["push_verify_delay"],
+			},
+			"log_timings": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GIT_PROVIDER_LOG_TIMINGS", false),
+				Description: descriptions["log_timings"],
+			},
+			"default_author": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the author, the name of the user of the token when empty.",
+						},
+						"email": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Email of the author, the public email of the user of the token, or their noreply address, when empty.",
+						},
+						"message": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Commit message template, `" + DefaultCommitMessage + "` by default.",
+						},
+					},
+				},
+				Description: descriptions["default_author"],
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"git_files": resourceGitFiles(),
 		},
-		DataSourcesMap: map[string]*schema.Resource{},
+		DataSourcesMap: map[string]*schema.Resource{
+			"git_diff": dataSourceGitDiff(),
+			"git_log":  dataSourceGitLog(),
+		},
 	}
 
 	p.ConfigureContextFunc = providerConfigure(p)
@@ -59,26 +167,85 @@ func init() {
 		"organization": "The GitHub organization name to manage. " +
 			"Use this field instead of `owner` when managing organization accounts.",
 		"insecure": "Enable `insecure` mode for testing purposes",
+		"allowed_path_prefixes": "Directories in the repositories resources may write files to, e.g. `config/generated`. " +
+			"Resources may write anywhere when not set.",
+		"line_endings": "Line endings of the files written by resources, `preserve` (default) writes the contents as " +
+			"configured, `lf` or `crlf` convert them. Files can override it.",
+		"ensure_trailing_newline": "Add a newline to the end of files written by resources when missing. " +
+			"Files can enable it on their own.",
+		"encoding": "Encoding of the files written by resources: `utf-8` (default), `utf-8-bom` or `utf-16le`. " +
+			"Files can override it.",
+		"dry_run": "Commit the changes of resources without pushing them, the commits are written to " +
+			"`dry_run_output_dir` instead. Can also be set with the `GIT_PROVIDER_DRY_RUN` environment variable.",
+		"dry_run_output_dir": "Directory the commits are written to in dry run mode, `git-dry-run` in the working " +
+			"directory by default. Can also be set with the `GIT_PROVIDER_DRY_RUN_OUTPUT_DIR` environment variable.",
+		"dry_run_format": "Format of the commits written in dry run mode: `bundle` (default) writes a git bundle, " +
+			"`patch` a directory with the patch series written by `git format-patch`.",
+		"lock_dir": "Directory holding lock files so Terraform processes sharing it, e.g. parallel jobs on one " +
+			"runner, write to a branch one at a time. Resources of one process are always serialized per branch. " +
+			"Can also be set with the `GIT_PROVIDER_LOCK_DIR` environment variable.",
+		"lock_timeout": "How long a resource waits for the lock of its branch, e.g. `30s`, `10m` by default. " +
+			"`0` waits until the operation is cancelled.",
+		"push_verify_retries": "How many more times the remote branch is checked for a pushed commit when it isn't " +
+			"there right after the push, for remotes replicating pushes with some lag. `0` by default.",
+		"push_verify_delay": "How long to wait before checking the remote branch again for a pushed commit, `5s` by default.",
+		"log_timings": "Log how long the git commands of every operation took, per subcommand, at `INFO` level of the " +
+			"`git` log subsystem. Can also be set with the `GIT_PROVIDER_LOG_TIMINGS` environment variable.",
+		"default_author": "Author and committer of the commits of `git_files` resources, used for whatever their " +
+			"`author` leaves out. Name and email left out here are those of the GitHub user of the token.",
 	}
 }
 
 func providerConfigure(p *schema.Provider) schema.ConfigureContextFunc {
 	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 		var diags diag.Diagnostics
+		ctx = logContext(ctx, d.Get("token").(string))
 		owner := d.Get("owner").(string)
 		token := d.Get("token").(string)
 		insecure := d.Get("insecure").(bool)
 		org := d.Get("organization").(string)
 		if org != "" {
-			log.Printf("[INFO] Selecting organization attribute as owner: %s", org)
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Selecting organization attribute as owner: %s", org))
 			owner = org
 		}
 
+		var allowed_path_prefixes []string
+		for _, v := range d.Get("allowed_path_prefixes").([]interface{}) {
+			allowed_path_prefixes = append(allowed_path_prefixes, v.(string))
+		}
+
 		config := Config{
-			Token:    token,
-			Insecure: insecure,
-			Owner:    owner,
-			Org:      org,
+			Token:               token,
+			Insecure:            insecure,
+			Owner:               owner,
+			Org:                 org,
+			AllowedPathPrefixes: allowed_path_prefixes,
+			LockDir:             d.Get("lock_dir").(string),
+			FileFormat: FileFormat{
+				LineEndings:           d.Get("line_endings").(string),
+				EnsureTrailingNewline: d.Get("ensure_trailing_newline").(bool),
+				Encoding:              d.Get("encoding").(string),
+			},
+		}
+		// the duration is validated by the schema
+		config.LockTimeout, _ = time.ParseDuration(d.Get("lock_timeout").(string))
+		config.PushVerifyRetries = d.Get("push_verify_retries").(int)
+		config.PushVerifyDelay, _ = time.ParseDuration(d.Get("push_verify_delay").(string))
+		config.LogTimings = d.Get("log_timings").(bool)
+		if v := d.Get("default_author").([]interface{}); len(v) > 0 && v[0] != nil {
+			default_author := v[0].(map[string]interface{})
+			config.DefaultAuthor = Author{
+				Name:    default_author["name"].(string),
+				Email:   default_author["email"].(string),
+				Message: default_author["message"].(string),
+			}
+		}
+		if d.Get("dry_run").(bool) {
+			config.DryRun = &DryRun{
+				OutputDir: d.Get("dry_run_output_dir").(string),
+				Format:    d.Get("dry_run_format").(string),
+			}
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Dry run, commits are written to %s instead of being pushed", config.DryRun.OutputDir))
 		}
 
 		meta, err := config.Meta()
@@ -94,6 +261,14 @@ func providerConfigure(p *schema.Provider) schema.ConfigureContextFunc {
 			return nil, diags
 		}
 
+		if config.Anonymous() {
+			tflog.SubsystemInfo(ctx, LogSubsystem, "No token present; configuring anonymous owner.")
+		} else {
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Token present; configuring authenticated owner: %s", meta.(*Owner).name))
+		}
+		if err := meta.(*Owner).identityErr; err != nil {
+			tflog.SubsystemDebug(ctx, LogSubsystem, fmt.Sprintf("Unable to look up the user of the token for the default author: %s", err))
+		}
 		meta.(*Owner).Context = ctx
 
 		return meta, nil
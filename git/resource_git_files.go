@@ -1,95 +1,1098 @@
 package git
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/go-pax/terraform-provider-git/utils/map_type"
 	"github.com/go-pax/terraform-provider-git/utils/set"
 	"github.com/go-pax/terraform-provider-git/utils/unique"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"time"
 )
 
 func resourceGitFiles() *schema.Resource {
 	return &schema.Resource{
+		Schema:        resourceGitFilesSchema(),
+		SchemaVersion: 2,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Type:    resourceGitFilesV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceGitFilesStateUpgradeV0,
+				Version: 0,
+			},
+			{
+				Type:    resourceGitFilesV1().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceGitFilesStateUpgradeV1,
+				Version: 1,
+			},
+		},
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+		CustomizeDiff: resourceCustomizeDiff,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceImport,
+		},
+	}
+}
+
+func resourceGitFilesSchema() map[string]*schema.Schema {
+	file_resource := &schema.Resource{
 		Schema: map[string]*schema.Schema{
-			"author": {
-				Type:     schema.TypeMap,
-				Required: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
+			"filepath": {
+				Type:             schema.TypeString,
+				Required:         true,
+				ValidateDiagFunc: validateFilePath,
+				Description:      "Relative path to the file in the targeted repository.",
+			},
+			"contents": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				DiffSuppressFunc: suppressContents,
+				Description:      "String contents of this file. Bested used with templates. Not used with `patch`.",
+			},
+			"patch": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Description: "Only set or delete keys of a JSON, YAML or TOML file instead of writing its contents, the " +
+					"order of the keys and the comments of the file are kept. Drift is only detected for the patched keys and destroy reverts them.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"format": {
+							Type:             schema.TypeString,
+							Optional:         true,
+							ValidateDiagFunc: validateStringInSlice([]string{PatchJson, PatchYaml, PatchToml}),
+							Description:      "Format of the file: `json`, `yaml` or `toml`. Defaults to the one of the file extension.",
+						},
+						"set": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "Keys to set, missing parent keys are created.",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"path": {
+										Type:     schema.TypeString,
+										Required: true,
+										Description: "JSON pointer to the key, e.g. `/scripts/build`. A last segment of `-` appends " +
+											"the value to a list unless it's already there.",
+									},
+									"value": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "JSON encoded value of the key, e.g. `jsonencode(\"tsc\")`.",
+									},
+								},
+							},
+						},
+						"delete": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "JSON pointers to the keys to delete.",
+						},
+					},
 				},
-				Description: "`object({ name=string, email=string, message=string })` Defines the commit user and message.",
 			},
-			"branch": {
+			"blob_sha": {
 				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "This is the branch the files will commit into. The branch must exist.",
+				Computed:    true,
+				Description: "Blob SHA of the file in the branch, empty when the file is missing.",
 			},
-			"hostname": {
-				Type:        schema.TypeString,
-				Default:     "github.com",
+			"line_endings": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateStringInSlice([]string{LineEndingsPreserve, LineEndingsLf, LineEndingsCrlf}),
+				Description:      "Line endings of the file: `preserve`, `lf` or `crlf`. Defaults to the `line_endings` of the provider.",
+			},
+			"ensure_trailing_newline": {
+				Type:        schema.TypeBool,
 				Optional:    true,
-				ForceNew:    true,
-				Description: "Defaults to `github.com` but since this is pure git change to whatever server you are committing into.",
+				Description: "Add a newline to the end of the file when missing, also enabled by the provider's `ensure_trailing_newline`.",
 			},
-			"repository": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "Respository name you want to commit into.",
+			"encoding": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateStringInSlice([]string{EncodingUtf8, EncodingUtf8Bom, EncodingUtf16le}),
+				Description:      "Encoding of the file: `utf-8`, `utf-8-bom` or `utf-16le`. Defaults to the `encoding` of the provider.",
+			},
+			"managed_block": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Description: "Only manage a block of the file between a begin and an end marker, the rest of the file is " +
+					"left as is. The block is added to the end of the file when the markers are absent, drift is only " +
+					"detected inside the block and only the block is removed on destroy.",
 			},
-			"organization": {
+			"marker": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateStringContains("{mark}"),
+				Description: "Template of the marker lines around a managed block, `{mark}` is replaced by `marker_begin` " +
+					"or `marker_end`. Defaults to `" + DefaultMarker + "`, use the comment syntax of the file.",
+			},
+			"marker_begin": {
 				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "Sets the organization in git the repository is in.",
+				Optional:    true,
+				Description: "Replaces `{mark}` in the begin marker of a managed block. Defaults to `" + DefaultMarkerBegin + "`.",
 			},
-			"project": {
+			"marker_end": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				ForceNew:    true,
-				Description: "Sets the AzureDevOps Project where the repository is in. Only needed if using AzDO repos",
+				Description: "Replaces `{mark}` in the end marker of a managed block. Defaults to `" + DefaultMarkerEnd + "`.",
 			},
-			"force_new": {
-				Type:     schema.TypeBool,
-				Optional: true,
-				Default:  false,
-				Description: "Ensure your files are always pushed into the branch. If the branch is generated in the " +
-					"apply and doesn't exist yet set this to true",
+			"contents_in_state": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          ContentsFull,
+				ValidateDiagFunc: validateStringInSlice([]string{ContentsFull, ContentsSha256, ContentsGitBlobSha}),
+				Description: "What is kept in state for `contents`: `full` keeps the contents, `sha256` or `git_blob_sha` " +
+					"only keep their hash prefixed with the algorithm, for large files. Drift is detected by comparing hashes.",
 			},
-			"file": {
-				Type:     schema.TypeSet,
-				Required: true,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"filepath": {
-							Type:        schema.TypeString,
-							Required:    true,
-							Description: "Relative path to the file in the targeted repository.",
-						},
-						"contents": {
-							Type:        schema.TypeString,
-							Required:    true,
-							Description: "String contents of this file. Bested used with templates",
-						},
+		},
+	}
+
+	return map[string]*schema.Schema{
+		"author": {
+			Type:     schema.TypeMap,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "`object({ name=string, email=string, message=string })` Defines the commit user and message. " +
+				"Keys left out are taken from the `default_author` of the provider, then from the user of the token. " +
+				"The message can hold `{action}`, `{files}`, `{repository}` and `{branch}` placeholders, it's `" +
+				DefaultCommitMessage + "` by default.",
+		},
+		"branch": {
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    true,
+			Description: "This is the branch the files will commit into. The branch must exist unless `create_branch` is set.",
+		},
+		"hostname": {
+			Type:        schema.TypeString,
+			Default:     "github.com",
+			Optional:    true,
+			ForceNew:    true,
+			Description: "Defaults to `github.com` but since this is pure git change to whatever server you are committing into.",
+		},
+		"repository": {
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    true,
+			Description: "Respository name you want to commit into.",
+		},
+		"organization": {
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    true,
+			Description: "Sets the organization in git the repository is in.",
+		},
+		"project": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			ForceNew:    true,
+			Description: "Sets the AzureDevOps Project where the repository is in. Only needed if using AzDO repos",
+		},
+		"force_new": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  false,
+			Description: "Ensure your files are always pushed into the branch. If the branch is generated in the " +
+				"apply and doesn't exist yet set this to true. Prefer `create_branch` when the branch is only " +
+				"needed for these files.",
+		},
+		"create_branch": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  false,
+			Description: "Create the branch from `base_ref` when it doesn't exist, instead of failing. " +
+				"A branch deleted outside of Terraform is created again on the next apply.",
+		},
+		"base_ref": {
+			Type:     schema.TypeString,
+			Optional: true,
+			Description: "Branch, tag or SHA the branch is created from when `create_branch` is set. Defaults to the " +
+				"default branch of the repository. Only used when the branch is created.",
+		},
+		"delete_branch_on_destroy": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  false,
+			Description: "Delete the branch on destroy when it was created by this resource, instead of committing " +
+				"the removal of the files. The branch is deleted even with `on_destroy = \"retain\"`.",
+		},
+		"branch_created": {
+			Type:        schema.TypeBool,
+			Computed:    true,
+			Description: "Whether the branch was created by this resource.",
+		},
+		"restore_drift": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  true,
+			Description: "Plan an update that restores managed files changed outside of Terraform. Set to false to " +
+				"only report the drift, e.g. for files that are created once and then owned by someone else.",
+		},
+		"overwrite_on_create": {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Default:          OverwriteFalse,
+			ValidateDiagFunc: validateStringInSlice([]string{OverwriteFalse, OverwriteTrue, OverwriteAdopt}),
+			Description: "What happens on create when a file already exists in the branch. `false` fails when the " +
+				"content differs, `true` overwrites it and `adopt` fails like `false` but takes ownership of files " +
+				"whose content already matches, so they are deleted even when `on_destroy = \"restore\"`.",
+		},
+		"on_destroy": {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Default:          OnDestroyDelete,
+			ValidateDiagFunc: validateStringInSlice([]string{OnDestroyDelete, OnDestroyRetain, OnDestroyRestore}),
+			Description: "What happens to the files when they are no longer managed. `delete` removes them, `retain` " +
+				"leaves them in the branch, unless `delete_branch_on_destroy` deletes the branch, and `restore` puts back the content they had before Terraform took them " +
+				"over, files that didn't exist are deleted.",
+		},
+		"commit_mode": {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Default:          CommitModeNew,
+			ValidateDiagFunc: validateStringInSlice([]string{CommitModeNew, CommitModeAmend}),
+			Description: "How changes are committed. `new` adds a commit on every apply, `amend` replaces the tip of " +
+				"the branch when it's the previous commit of the resource, identified by its `" + CommitTrailer + "` " +
+				"trailer, and force pushes it with a lease. A new commit is made when someone else committed on top.",
+		},
+		"pre_push_check": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Description: "Commands validating the changes before they are committed and pushed, e.g. `yamllint .`, run " +
+				"in order in the checkout where the changes are staged. A command exiting with a non-zero code stops the " +
+				"apply with its output.",
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"command": {
+						Type:        schema.TypeString,
+						Required:    true,
+						Description: "The command to run, passed to the interpreter as its last argument.",
+					},
+					"interpreter": {
+						Type:        schema.TypeList,
+						Optional:    true,
+						Elem:        &schema.Schema{Type: schema.TypeString},
+						Description: "The interpreter and its arguments, `[\"/bin/sh\", \"-c\"]` by default, `[\"cmd\", \"/C\"]` on Windows.",
+					},
+					"working_dir": {
+						Type:             schema.TypeString,
+						Optional:         true,
+						Default:          ".",
+						ValidateDiagFunc: validateFilePath,
+						Description:      "Directory the command runs in, relative to the repository root.",
+					},
+					"env": {
+						Type:        schema.TypeMap,
+						Optional:    true,
+						Elem:        &schema.Schema{Type: schema.TypeString},
+						Description: "Environment variables set for the command on top of the ones of Terraform.",
+					},
+					"timeout": {
+						Type:             schema.TypeString,
+						Optional:         true,
+						Default:          "5m",
+						ValidateDiagFunc: validateDuration,
+						Description:      "How long the command may run, e.g. `30s`. `0` doesn't limit it.",
 					},
 				},
 			},
 		},
-		CreateContext: resourceCreate,
-		ReadContext:   resourceRead,
-		UpdateContext: resourceUpdate,
-		DeleteContext: resourceDelete,
+		"push_options": {
+			Type:        schema.TypeList,
+			Optional:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "Options passed to every push with `git push -o`, e.g. `merge_request.create` on GitLab.",
+		},
+		"skip_ci": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  false,
+			Description: "Keep the commits from triggering pipelines, the way the host understands: the `ci.skip` push " +
+				"option on GitLab, `***NO_CI***` in the message on Azure DevOps, `[skip ci]` and the `skip-checks: true` " +
+				"trailer on GitHub and `[skip ci]` elsewhere.",
+		},
+		"run_repo_hooks": {
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  true,
+			Description: "Run the git hooks configured for the checkout, such as `pre-commit` and `pre-push` hooks of a " +
+				"global `core.hooksPath`, when committing and pushing. `false` skips them with `--no-verify`.",
+		},
+		"original_files": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Blob SHA each file had in the branch before Terraform took it over, keyed by path. Empty for " +
+				"files created by Terraform.",
+		},
+		"original_values": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "JSON value every patched key had before Terraform patched it, keyed by the path of the file and " +
+				"the JSON pointer of the key, e.g. `package.json#/scripts/build`. Empty for keys that didn't exist.",
+		},
+		"file_hashes": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Blob SHA of every managed file in the branch, keyed by path. Empty for missing files.",
+		},
+		"drifted_files": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Managed files changed outside of Terraform, keyed by path. The value is a comma separated list " +
+				"of `modified`, `deleted` or `mode_changed`.",
+		},
+		"commit_sha": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "SHA of the last commit pushed by this resource.",
+		},
+		"commit_url": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "Web URL of `commit_sha`.",
+		},
+		"branch_head_sha": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "SHA of the head of the branch when the resource was last read or applied.",
+		},
+		"moved_files": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Files moved by the last change of `file`, keyed by their previous path. A file is moved with " +
+				"`git mv` when its path changes while its contents stay the same.",
+		},
+		"planned_diff": {
+			Type:     schema.TypeMap,
+			Computed: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Unified diff of every file the plan changes in the branch, keyed by path. Computed at plan time " +
+				"against the current branch content and emptied by the next refresh. Diffs are cut after 4 KB, files " +
+				"whose `contents_in_state` isn't `full` only get a summary of the change. The plugin SDK can't attach " +
+				"warnings to a plan, the planned diff is only shown as the change of this attribute in the plan output.",
+		},
+		"file": {
+			Type:     schema.TypeSet,
+			Required: true,
+			Elem:     file_resource,
+			Set:      fileSetHash(file_resource),
+		},
+	}
+}
+
+// resourceImport adopts files already in the branch. The ID has the form
+// `hostname/organization/repository:branch:path1,path2` where every path can be a glob, for AzDO
+// repos the project goes between the organization and the repository.
+func resourceImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	id, err := parseImportId(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{
+		"hostname":            id.Hostname,
+		"organization":        id.Organization,
+		"project":             id.Project,
+		"repository":          id.Repository,
+		"branch":              id.Branch,
+		"force_new":           false,
+		"restore_drift":       true,
+		"on_destroy":          OnDestroyDelete,
+		"overwrite_on_create": OverwriteFalse,
+		"create_branch":       false,
+		"branch_created":      false,
+	}
+	for k, v := range values {
+		if err := d.Set(k, v); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", k, err)
+		}
+	}
+
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, id.Organization, id.Hostname)
+	ctx, done := logOperation(ctx, commands, "import", id.Repository, id.Project, id.Branch, meta)
+	defer done()
+	unlock, err := lockBranch(ctx, commands, id.Repository, id.Project, id.Branch, meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock branch %s: %w", id.Branch, err)
+	}
+	defer unlock()
+
+	checkout_dir, rev, status, release, err := meta.(*Owner).checkouts.checkout(ctx, commands, id.Repository, id.Branch, id.Project)
+	defer release()
+	switch status {
+	case NotExist:
+		return nil, fmt.Errorf("branch %s not found in %s", id.Branch, id.Repository)
+	case Unknown:
+		if err != nil {
+			return nil, fmt.Errorf("failed to checkout branch %s of %s: %w", id.Branch, id.Repository, err)
+		}
+	}
+
+	var files []interface{}
+	var filepaths []string
+	var missing_files []string
+	for _, pattern := range id.Paths {
+		out, err := gitOutput(ctx, checkout_dir, "-c", "core.quotePath=false", "ls-files", "-z", "--", ":(glob)"+pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files matching %s: %w", pattern, err)
+		}
+		matches := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if len(matches) == 1 && matches[0] == "" {
+			missing_files = append(missing_files, pattern)
+			continue
+		}
+		for _, filepath := range matches {
+			filepaths = append(filepaths, filepath)
+			contents, err := os.ReadFile(path.Join(checkout_dir, filepath))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %w", filepath, err)
+			}
+			files = append(files, map[string]interface{}{
+				"filepath":          filepath,
+				"contents":          string(contents),
+				"contents_in_state": ContentsFull,
+			})
+		}
+	}
+	if len(missing_files) > 0 {
+		return nil, fmt.Errorf("the following files don't exist in branch %s of %s:\n%s", id.Branch, id.Repository, strings.Join(missing_files, "\n"))
+	}
+
+	if err := d.Set("file", files); err != nil {
+		return nil, fmt.Errorf("failed to set git files: %w", err)
+	}
+	entries, err := commands.lsTree(ctx, checkout_dir, "HEAD", filepaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in branch %s: %w", id.Branch, err)
+	}
+	if err := d.Set("original_files", originalFiles(d, entries)); err != nil {
+		return nil, fmt.Errorf("failed to set original files: %w", err)
+	}
+	if err := d.Set("branch_head_sha", rev); err != nil {
+		return nil, fmt.Errorf("failed to set branch head: %w", err)
+	}
+	tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Imported %d files from branch %s (HEAD): %s", len(files), id.Branch, rev))
+	d.SetId(resourceId(id.Hostname, id.Organization, id.Project, id.Repository, id.Branch, filepaths))
+
+	return []*schema.ResourceData{d}, nil
+}
+
+const (
+	OverwriteFalse = "false"
+	OverwriteTrue  = "true"
+	OverwriteAdopt = "adopt"
+
+	OnDestroyDelete  = "delete"
+	OnDestroyRetain  = "retain"
+	OnDestroyRestore = "restore"
+
+	ReleaseDeleted       = "deleted"
+	ReleaseRestored      = "restored"
+	ReleaseBlockRemoved  = "block_removed"
+	ReleasePatchReverted = "patch_reverted"
+
+	DriftModified    = "modified"
+	DriftDeleted     = "deleted"
+	DriftModeChanged = "mode_changed"
+
+	regularFileMode = "100644"
+)
+
+// resourceCustomizeDiff turns the drift found by resourceRead into a per path diff of
+// drifted_files, so the plan shows which files are restored and why instead of set churn.
+func resourceCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.NewValueKnown("file") {
+		files := plannedFiles(d)
+		diags := validateFilePaths(filePaths(files), meta.(*Owner).allowedPathPrefixes)
+		for _, diagnostic := range diags {
+			if diagnostic.Severity == diag.Error {
+				return fmt.Errorf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+			}
+		}
+		if err := validateFilePatches(files); err != nil {
+			return err
+		}
+	}
+
+	if d.Id() == "" {
+		return setPlannedDiff(ctx, d, meta)
+	}
+
+	files_changed := filesChanged(d)
+	drifted_files := d.Get("drifted_files").(map[string]interface{})
+	restore := len(drifted_files) > 0 && d.Get("restore_drift").(bool)
+	if restore {
+		for filepath, drift := range drifted_files {
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Restoring file changed outside of Terraform: %s (%s)", filepath, drift))
+		}
+		if err := d.SetNew("drifted_files", map[string]interface{}{}); err != nil {
+			return err
+		}
+	}
+	if restore || files_changed {
+		for _, k := range []string{"file_hashes", "commit_sha", "commit_url", "branch_head_sha"} {
+			if err := d.SetNewComputed(k); err != nil {
+				return err
+			}
+		}
+		if err := setPlannedDiff(ctx, d, meta); err != nil {
+			return err
+		}
+	}
+	if files_changed {
+		if !d.NewValueKnown("file") {
+			if err := d.SetNewComputed("moved_files"); err != nil {
+				return err
+			}
+		} else {
+			old_files, _ := d.GetChange("file")
+			original_files, _ := d.GetChange("original_files")
+			old_set, new_set := old_files.(*schema.Set), plannedFiles(d)
+			renames := fileRenames(movableContents(fileContents(old_set), old_set, new_set), movableContents(fileContents(new_set), old_set, new_set),
+				d.Get("on_destroy").(string), original_files.(map[string]interface{}))
+			moved_files := map[string]interface{}{}
+			for from, to := range renames {
+				tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Moving file: %s -> %s", from, to))
+				moved_files[from] = to
+			}
+			if err := d.SetNew("moved_files", moved_files); err != nil {
+				return err
+			}
+		}
+		for _, k := range []string{"original_files", "original_values"} {
+			if err := d.SetNewComputed(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseFile stops managing the file according to on_destroy. It returns ReleaseDeleted,
+// ReleaseRestored, ReleaseBlockRemoved or ReleasePatchReverted when the checkout changed, or an
+// empty string when the file is left as is. Only the block is removed from a file managing a
+// block, and only the patched keys are reverted in a patched file.
+func releaseFile(ctx context.Context, checkout_dir string, file map[string]interface{}, defaults FileFormat, on_destroy string, original_sha string, original_values map[string]interface{}) (string, error) {
+	filepath := file["filepath"].(string)
+	full_path := path.Join(checkout_dir, filepath)
+	format := fileFormat(file, defaults)
+	markers, patch := fileBlock(file), filePatch(file)
+	switch {
+	case on_destroy == OnDestroyRetain:
+		return "", nil
+	case markers != nil:
+		return releaseBlock(checkout_dir, filepath, *markers, format, original_sha == "")
+	case patch != nil:
+		return releasePatch(checkout_dir, filepath, *patch, format, fileOriginalValues(original_values, filepath), nil, original_sha == "")
+	case on_destroy == OnDestroyRestore && original_sha != "":
+		contents, err := gitOutput(ctx, checkout_dir, "cat-file", "blob", original_sha)
+		if err != nil {
+			return "", fmt.Errorf("failed to read original content of %s: %w", filepath, err)
+		}
+		if err := os.Remove(full_path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err := os.MkdirAll(path.Dir(full_path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(full_path, contents, 0666); err != nil {
+			return "", err
+		}
+		return ReleaseRestored, nil
+	default:
+		if err := os.Remove(full_path); err != nil {
+			if os.IsNotExist(err) {
+				// already deleted outside of terraform
+				return "", nil
+			}
+			return "", err
+		}
+		return ReleaseDeleted, nil
 	}
 }
 
+// releaseBlock removes the managed block from the file, the file is deleted when nothing else is
+// left in it and delete_empty is set.
+func releaseBlock(checkout_dir string, filepath string, markers BlockMarkers, format FileFormat, delete_empty bool) (string, error) {
+	full_path := path.Join(checkout_dir, filepath)
+	out, err := os.ReadFile(full_path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// already deleted outside of terraform
+			return "", nil
+		}
+		return "", err
+	}
+	text, err := decodeContents(out, format.Encoding)
+	if err != nil {
+		return "", err
+	}
+	text, ok := removeBlock(text, markers)
+	if !ok {
+		// already removed outside of terraform
+		return "", nil
+	}
+	if text == "" && delete_empty {
+		if err := os.Remove(full_path); err != nil {
+			return "", err
+		}
+		return ReleaseDeleted, nil
+	}
+	if err := os.WriteFile(full_path, encodeContents(text, FileFormat{Encoding: format.Encoding}), 0666); err != nil {
+		return "", err
+	}
+	return ReleaseBlockRemoved, nil
+}
+
+// releasePatch reverts the patched keys not in keep, the file is deleted when nothing else is
+// left in it and delete_empty is set.
+func releasePatch(checkout_dir string, filepath string, patch FilePatch, format FileFormat, originals map[string]string, keep map[string]bool, delete_empty bool) (string, error) {
+	full_path := path.Join(checkout_dir, filepath)
+	out, err := os.ReadFile(full_path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// already deleted outside of terraform
+			return "", nil
+		}
+		return "", err
+	}
+	text, err := decodeContents(out, format.Encoding)
+	if err != nil {
+		return "", err
+	}
+	reverted, empty, err := revertPatch(text, patch, originals, keep)
+	if err != nil {
+		return "", err
+	}
+	if empty && delete_empty {
+		if err := os.Remove(full_path); err != nil {
+			return "", err
+		}
+		return ReleaseDeleted, nil
+	}
+	if reverted == text {
+		return "", nil
+	}
+	if err := os.WriteFile(full_path, encodeContents(reverted, FileFormat{Encoding: format.Encoding}), 0666); err != nil {
+		return "", err
+	}
+	return ReleasePatchReverted, nil
+}
+
+// writePatch returns the bytes of the checked out file with the patch applied to it, the bytes
+// are left as is when the patch doesn't change anything.
+func writePatch(checkout_dir string, filepath string, patch FilePatch, format FileFormat) ([]byte, error) {
+	out, err := os.ReadFile(path.Join(checkout_dir, filepath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	text := ""
+	if len(out) > 0 {
+		if text, err = decodeContents(out, format.Encoding); err != nil {
+			return nil, err
+		}
+	}
+	patched, err := applyPatch(text, patch)
+	if err != nil {
+		return nil, err
+	}
+	if patched == text && len(out) > 0 {
+		return out, nil
+	}
+	return encodeContents(patched, FileFormat{LineEndings: format.LineEndings, Encoding: format.Encoding}), nil
+}
+
+// fileOriginalValues returns the original values of the patched keys of a file keyed by patchKey.
+func fileOriginalValues(original_values map[string]interface{}, filepath string) map[string]string {
+	originals := map[string]string{}
+	for k, v := range original_values {
+		if key, ok := strings.CutPrefix(k, filepath+"#"); ok {
+			originals[key], _ = v.(string)
+		}
+	}
+	return originals
+}
+
+// originalValues returns the value every patched key has in the checkout before it's patched.
+// Keys already patched keep the value recorded in state.
+func originalValues(d *schema.ResourceData, checkout_dir string, defaults FileFormat) (map[string]interface{}, error) {
+	v, _ := d.GetChange("original_values")
+	previous := v.(map[string]interface{})
+	original_values := map[string]interface{}{}
+	for _, v := range d.Get("file").(*schema.Set).List() {
+		file := v.(map[string]interface{})
+		patch := filePatch(file)
+		if patch == nil {
+			continue
+		}
+		filepath := file["filepath"].(string)
+		out, err := os.ReadFile(path.Join(checkout_dir, filepath))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		text := ""
+		if len(out) > 0 {
+			if text, err = decodeContents(out, fileFormat(file, defaults).Encoding); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", filepath, err)
+			}
+		}
+		originals, err := patchOriginals(text, *patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath, err)
+		}
+		for key, value := range originals {
+			k := filepath + "#" + key
+			if v, ok := previous[k]; ok {
+				original_values[k] = v
+			} else {
+				original_values[k] = value
+			}
+		}
+	}
+	return original_values, nil
+}
+
+// validateFilePatches checks the patches of the file blocks.
+func validateFilePatches(files *schema.Set) error {
+	for _, v := range files.List() {
+		file := v.(map[string]interface{})
+		patch := filePatch(file)
+		if patch == nil {
+			continue
+		}
+		filepath := file["filepath"].(string)
+		if contents, _ := file["contents"].(string); contents != "" {
+			return fmt.Errorf("file %s: contents can't be set with patch", filepath)
+		}
+		if fileBlock(file) != nil {
+			return fmt.Errorf("file %s: managed_block can't be set with patch", filepath)
+		}
+		if err := validatePatch(filepath, *patch); err != nil {
+			return fmt.Errorf("file %s: %w", filepath, err)
+		}
+	}
+	return nil
+}
+
+// writeBlock returns the bytes of the checked out file with the managed block written into it.
+func writeBlock(checkout_dir string, filepath string, contents string, markers BlockMarkers, format FileFormat) ([]byte, error) {
+	out, err := os.ReadFile(path.Join(checkout_dir, filepath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return blockFile(out, contents, markers, format)
+}
+
+// originalFiles returns the blob SHA every file had before Terraform took it over. Files already
+// managed keep the SHA recorded in state.
+func originalFiles(d *schema.ResourceData, entries map[string]TreeEntry) map[string]interface{} {
+	v, _ := d.GetChange("original_files")
+	previous := v.(map[string]interface{})
+	original_files := map[string]interface{}{}
+	for _, v := range d.Get("file").(*schema.Set).List() {
+		filepath := v.(map[string]interface{})["filepath"].(string)
+		if sha, ok := previous[filepath]; ok {
+			original_files[filepath] = sha
+		} else {
+			original_files[filepath] = entries[filepath].Sha
+		}
+	}
+	return original_files
+}
+
+// fileDrift compares the checked out file with the contents kept in state and returns how it
+// drifted, or an empty string when it didn't. A file still at the blob SHA recorded by the last
+// apply didn't drift, whatever git did to it on checkout. Only the block of a file managing a
+// block is compared, a block removed from the file is reported as deleted. Only the patched keys
+// of a patched file are compared.
+func fileDrift(checkout_dir string, file map[string]interface{}, defaults FileFormat, entry *TreeEntry, recorded_sha string) string {
+	if entry == nil {
+		return DriftDeleted
+	}
+	filepath, contents := file["filepath"].(string), file["contents"].(string)
+	format := fileFormat(file, defaults)
+	markers, patch := fileBlock(file), filePatch(file)
+	var drift []string
+	if entry.Sha != recorded_sha {
+		out, err := os.ReadFile(path.Join(checkout_dir, filepath))
+		switch {
+		case err != nil:
+			drift = append(drift, DriftModified)
+		case patch != nil:
+			if text, err := decodeContents(out, format.Encoding); err != nil {
+				drift = append(drift, DriftModified)
+			} else if matches, err := patchMatches(text, *patch); err != nil || !matches {
+				drift = append(drift, DriftModified)
+			}
+		case markers != nil:
+			if found, matches := blockMatches(out, contents, *markers, format); !found {
+				drift = append(drift, DriftDeleted)
+			} else if !matches {
+				drift = append(drift, DriftModified)
+			}
+		case !fileMatches(out, contents, format):
+			drift = append(drift, DriftModified)
+		}
+	}
+	if entry.Mode != regularFileMode {
+		drift = append(drift, DriftModeChanged)
+	}
+	return strings.Join(drift, ",")
+}
+
+// filePaths returns the paths of the given file blocks.
+func filePaths(files *schema.Set) []string {
+	var filepaths []string
+	for _, v := range files.List() {
+		filepaths = append(filepaths, v.(map[string]interface{})["filepath"].(string))
+	}
+	return filepaths
+}
+
+// validateCheckout validates the managed paths before the checkout is changed.
+func validateCheckout(checkout_dir string, filepaths []string, meta interface{}) diag.Diagnostics {
+	diags := validateFilePaths(filepaths, meta.(*Owner).allowedPathPrefixes)
+	if diags.HasError() {
+		return diags
+	}
+	for _, filepath := range filepaths {
+		if err := checkCheckoutPath(checkout_dir, filepath); err != nil {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid file path",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("file"),
+			})
+		}
+	}
+	return diags
+}
+
+// setFileHashes records the blob SHA of every managed file at HEAD and clears the drift, it is
+// called once the branch holds exactly the configured files.
+func setFileHashes(ctx context.Context, d *schema.ResourceData, commands *GitCommands, checkout_dir string) error {
+	filepaths := filePaths(d.Get("file").(*schema.Set))
+	entries, err := commands.lsTree(ctx, checkout_dir, "HEAD", filepaths)
+	if err != nil {
+		return err
+	}
+
+	file_hashes := map[string]interface{}{}
+	for _, filepath := range filepaths {
+		file_hashes[filepath] = entries[filepath].Sha
+	}
+	if err := d.Set("file_hashes", file_hashes); err != nil {
+		return err
+	}
+	if err := setBlobShas(d, entries); err != nil {
+		return err
+	}
+	return d.Set("drifted_files", map[string]interface{}{})
+}
+
+// setBlobShas sets the blob_sha of every file block from the tree entries of the branch.
+func setBlobShas(d *schema.ResourceData, entries map[string]TreeEntry) error {
+	var files []interface{}
+	for _, v := range d.Get("file").(*schema.Set).List() {
+		file := map[string]interface{}{}
+		for k, v := range v.(map[string]interface{}) {
+			file[k] = v
+		}
+		file["blob_sha"] = entries[file["filepath"].(string)].Sha
+		files = append(files, file)
+	}
+	return d.Set("file", files)
+}
+
+// setCommit records the commit the branch is at after an apply, commit_sha only changes when
+// this resource pushed it.
+func setCommit(d *schema.ResourceData, commands *GitCommands, sha string, pushed bool) error {
+	project := d.Get("project").(string)
+	repo := d.Get("repository").(string)
+	if pushed {
+		if err := d.Set("commit_sha", sha); err != nil {
+			return err
+		}
+		if err := d.Set("commit_url", commands.commitUrl(repo, project, sha)); err != nil {
+			return err
+		}
+	}
+	if err := d.Set("branch_head_sha", sha); err != nil {
+		return err
+	}
+	d.SetId(resourceId(d.Get("hostname").(string), d.Get("organization").(string), project, repo,
+		d.Get("branch").(string), filePaths(d.Get("file").(*schema.Set))))
+	return nil
+}
+
+// commitChanges commits the staged changes with the author and message of the resource, the
+// message template filled in for the action. With
+// `commit_mode = "amend"` the commit carries a trailer identifying the resource, and replaces the
+// tip of the branch when it's the previous commit of the resource. The SHA of the replaced commit
+// is returned so the push can lease it, it's empty when a new commit was made.
+func commitChanges(ctx context.Context, checkout_dir string, commands *GitCommands, d *schema.ResourceData, action string, commit_body string, meta interface{}) (string, error) {
+	author, err := commitAuthor(d, meta)
+	if err != nil {
+		return "", err
+	}
+	commit_message := commitMessage(author.Message, action, d)
+	var trailers []string
+	if d.Get("skip_ci").(bool) {
+		skip_ci := skipCi(d.Get("hostname").(string))
+		if skip_ci.Marker != "" {
+			commit_message += " " + skip_ci.Marker
+		}
+		trailers = append(trailers, skip_ci.Trailers...)
+	}
+	commit_command := flatten(committerConfig(meta), "commit", "-m", commit_message)
+	var lease string
+	if d.Get("commit_mode").(string) == CommitModeAmend {
+		id := resourceId(d.Get("hostname").(string), d.Get("organization").(string), d.Get("project").(string),
+			d.Get("repository").(string), d.Get("branch").(string), filePaths(d.Get("file").(*schema.Set)))
+		previous_id := d.Id()
+		if previous_id == "" {
+			previous_id = id
+		}
+		tip, err := amendableTip(ctx, checkout_dir, previous_id)
+		if err != nil {
+			return "", err
+		}
+		if tip != "" {
+			if commit_body, err = amendedBody(ctx, checkout_dir); err != nil {
+				return "", err
+			}
+			commit_command = append(commit_command, "--amend")
+			lease = tip
+		}
+		trailers = append(trailers, commitTrailer(id))
+	}
+	commit_command = append(commit_command, "-m", commit_body)
+	if len(trailers) > 0 {
+		commit_command = append(commit_command, "-m", strings.Join(trailers, "\n"))
+	}
+	commit_command = append(commit_command, "--allow-empty")
+	if !d.Get("run_repo_hooks").(bool) {
+		commit_command = append(commit_command, "--no-verify")
+	}
+	commit_command = append(commit_command, commands.getAuthorString(author.Name, author.Email)...)
+	commit_command = append(commit_command, "--")
+	if _, err := gitCommand(ctx, checkout_dir, commit_command...); err != nil {
+		return "", err
+	}
+	return lease, nil
+}
+
+// pushCommit pushes the commit checked out in checkout_dir to the branch, forcing it over the
+// commit lease when it's set as long as the branch still points to it, and invalidates the pooled
+// checkout of the branch. In dry run mode the commit is written to the output directory instead
+// and a warning tells where.
+func pushCommit(ctx context.Context, checkout_dir string, commands *GitCommands, d *schema.ResourceData, lease string, meta interface{}) (diag.Diagnostics, error) {
+	repo := d.Get("repository").(string)
+	project := d.Get("project").(string)
+	branch := d.Get("branch").(string)
+	dry_run := meta.(*Owner).dryRun
+	if dry_run == nil {
+		push_command := flatten("push", pushFlags(d))
+		if lease != "" {
+			push_command = append(push_command, fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", branch, lease))
+		}
+		_, err := gitCommand(ctx, checkout_dir, append(push_command, "origin", "HEAD")...)
+		meta.(*Owner).checkouts.invalidate(commands.lockKey(repo, project, branch))
+		if err != nil {
+			return nil, err
+		}
+		return verifyPush(ctx, checkout_dir, commands, repo, branch, meta), nil
+	}
+	target, err := commands.writeDryRun(ctx, checkout_dir, repo, branch, *dry_run)
+	if err != nil {
+		return nil, err
+	}
+	tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Dry run, commit to branch %s written to %s", branch, target))
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Dry run: commit not pushed",
+		Detail:   fmt.Sprintf("The commit to branch %s of %s was written to %s instead of being pushed.", branch, repo, target),
+	}}, nil
+}
+
+// verifyPush checks that the remote branch points to the commit pushed from checkout_dir, or to a
+// descendant of it, since server side hooks and policies may rewrite or quarantine pushes. It
+// checks again after push_verify_delay up to push_verify_retries times for replication lag.
+func verifyPush(ctx context.Context, checkout_dir string, commands *GitCommands, repo string, branch string, meta interface{}) diag.Diagnostics {
+	out, err := gitCommand(ctx, checkout_dir, "rev-parse", "HEAD")
+	if err != nil {
+		return diag.Errorf("failed to get revision")
+	}
+	sha := strings.TrimRight(string(out), "\n")
+
+	retries := meta.(*Owner).pushVerifyRetries
+	var remote_sha string
+	for attempt := 0; ; attempt++ {
+		var contains bool
+		remote_sha, contains, err = commands.remoteContains(ctx, checkout_dir, branch, sha)
+		if err == nil && contains {
+			return nil
+		}
+		if attempt >= retries {
+			break
+		}
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Pushed commit %s not found on branch %s yet, checking again (%d/%d)", sha, branch, attempt+1, retries))
+		select {
+		case <-ctx.Done():
+			retries = attempt
+		case <-time.After(meta.(*Owner).pushVerifyDelay):
+		}
+	}
+
+	var detail string
+	switch {
+	case err != nil:
+		detail = fmt.Sprintf("The commit %s was pushed to branch %s of %s, but the remote branch couldn't be checked: %s", sha, branch, repo, err)
+	case remote_sha == "":
+		detail = fmt.Sprintf("The commit %s was pushed to branch %s of %s, but the branch doesn't exist on the remote.", sha, branch, repo)
+	default:
+		detail = fmt.Sprintf("The commit %s was pushed to branch %s of %s, but the branch points to %s which doesn't contain it.", sha, branch, repo, remote_sha)
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  "Pushed commit not found on the remote branch",
+		Detail: detail + " A server side hook or policy may have rewritten or rejected the push, the state may not match " +
+			"the branch. Set push_verify_retries on the provider if the remote is slow to show pushes.",
+	}}
+}
+
 func resourceDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	hostname := d.Get("hostname").(string)
 	org := d.Get("organization").(string)
@@ -99,43 +1102,92 @@ func resourceDelete(ctx context.Context, d *schema.ResourceData, meta interface{
 	if v, ok := d.GetOk("project"); ok {
 		azdoProject = v.(string)
 	}
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, "delete", repo, azdoProject, branch, meta)
+	defer done()
+
+	on_destroy := d.Get("on_destroy").(string)
+	// deleting a branch the resource created wins over retaining the files in it
+	delete_branch := d.Get("branch_created").(bool) && d.Get("delete_branch_on_destroy").(bool)
+	if on_destroy == OnDestroyRetain && !delete_branch {
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Retaining files in branch: %s", branch))
+		return nil
+	}
+
+	unlock, err := lockBranch(ctx, commands, repo, azdoProject, branch, meta)
+	if err != nil {
+		return diag.Errorf("failed to lock branch %s: %s", branch, err)
+	}
+	defer unlock()
 
 	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
 	if err := os.MkdirAll(checkout_dir, 0755); err != nil {
 		return diag.Errorf("failed to create git temp dir: %s", err)
 	}
-	lockCheckout(checkout_dir)
 	defer func() {
-		unlockCheckout(checkout_dir)
 		_ = os.RemoveAll(checkout_dir)
 	}()
 
-	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
-
-	_, status, err := commands.checkout(checkout_dir, repo, branch, azdoProject)
+	_, status, err := commands.checkout(ctx, checkout_dir, repo, branch, azdoProject)
 	switch status {
 	case Exist:
-		tflog.Info(ctx, "Branch exists for deletion")
+		tflog.SubsystemInfo(ctx, LogSubsystem, "Branch exists for deletion")
 	case NotExist:
-		tflog.Warn(ctx, fmt.Sprintf("Branch already deleted: %s", branch))
+		tflog.SubsystemWarn(ctx, LogSubsystem, fmt.Sprintf("Branch already deleted: %s", branch))
 		return nil
 	case Unknown:
 		if err != nil {
-			return diag.Errorf("failed to checkout branch %s: %s", branch, err)
+			return gitDiagnostics(err, fmt.Sprintf("failed to checkout branch %s of %s", branch, repo))
 		}
 	}
 
+	if delete_branch {
+		if meta.(*Owner).dryRun != nil {
+			return diag.Diagnostics{{
+				Severity: diag.Warning,
+				Summary:  "Dry run: branch not deleted",
+				Detail:   fmt.Sprintf("Branch %s of %s would be deleted, it's left as is in dry run mode.", branch, repo),
+			}}
+		}
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Deleting branch created by terraform: %s", branch))
+		if _, err := gitCommand(ctx, checkout_dir, flatten("push", pushFlags(d), "origin", "--delete", branch)...); err != nil {
+			return gitDiagnostics(err, fmt.Sprintf("failed to delete branch %s", branch))
+		}
+		meta.(*Owner).checkouts.invalidate(commands.lockKey(repo, azdoProject, branch))
+		return nil
+	}
+
 	var deleted_files []string
+	var restored_files []string
+	var removed_blocks []string
+	var reverted_patches []string
 	files := d.Get("file")
+	original_files := map_type.ToTypedObject(d.Get("original_files").(map[string]interface{}))
 	is_clean := true
 	for _, v := range files.(*schema.Set).List() {
 		file := map_type.ToTypedObject(v.(map[string]interface{}))
 		filepath := file["filepath"]
 
-		if err := os.Remove(path.Join(checkout_dir, filepath)); err != nil {
-			return diag.Errorf("failed to delete file %s: %s", filepath, err)
+		if err := checkCheckoutPath(checkout_dir, filepath); err != nil {
+			return diag.Errorf("failed to release file %s: %s", filepath, err)
+		}
+		released, err := releaseFile(ctx, checkout_dir, v.(map[string]interface{}), meta.(*Owner).fileFormat, on_destroy,
+			original_files[filepath], d.Get("original_values").(map[string]interface{}))
+		if err != nil {
+			return diag.Errorf("failed to release file %s: %s", filepath, err)
+		}
+		switch released {
+		case ReleaseDeleted:
+			deleted_files = append(deleted_files, filepath)
+		case ReleaseRestored:
+			restored_files = append(restored_files, filepath)
+		case ReleaseBlockRemoved:
+			removed_blocks = append(removed_blocks, filepath)
+		case ReleasePatchReverted:
+			reverted_patches = append(reverted_patches, filepath)
+		default:
+			continue
 		}
-		deleted_files = append(deleted_files, filepath)
 		is_clean = false
 	}
 
@@ -143,24 +1195,216 @@ func resourceDelete(ctx context.Context, d *schema.ResourceData, meta interface{
 		return nil
 	}
 
-	if _, err := gitCommand(checkout_dir, "add", "--", "."); err != nil {
+	if _, err := gitCommand(ctx, checkout_dir, "add", "--", "."); err != nil {
 		return diag.Errorf("failed to add files to git: %s", err)
 	}
 
-	a := d.Get("author")
-	author := map_type.ToTypedObject(a.(map[string]interface{}))
-	commit_message := author["message"]
-	commit_body := fmt.Sprintf("The following files were deleted by terraform:\n%s", strings.Join(deleted_files, "\n"))
-	commit_command := flatten("commit", "-m", commit_message, "-m", commit_body, "--allow-empty")
-	commit_command = append(commit_command, commands.getAuthorString(author["name"], author["email"])...)
-	if _, err := gitCommand(checkout_dir, commit_command...); err != nil {
+	var commit_body string
+	if len(deleted_files) > 0 {
+		commit_body = fmt.Sprintf("The following files were deleted by terraform:\n%s", strings.Join(deleted_files, "\n"))
+	}
+	if len(restored_files) > 0 {
+		if commit_body != "" {
+			commit_body += "\n\n"
+		}
+		commit_body += fmt.Sprintf("The following files were restored by terraform:\n%s", strings.Join(restored_files, "\n"))
+	}
+	if len(removed_blocks) > 0 {
+		if commit_body != "" {
+			commit_body += "\n\n"
+		}
+		commit_body += fmt.Sprintf("The managed blocks of the following files were removed by terraform:\n%s", strings.Join(removed_blocks, "\n"))
+	}
+	if len(reverted_patches) > 0 {
+		if commit_body != "" {
+			commit_body += "\n\n"
+		}
+		commit_body += fmt.Sprintf("The patched keys of the following files were reverted by terraform:\n%s", strings.Join(reverted_patches, "\n"))
+	}
+	if check_diags := runPrePushChecks(ctx, checkout_dir, d); check_diags.HasError() {
+		return check_diags
+	}
+	lease, err := commitChanges(ctx, checkout_dir, commands, d, CommitActionDelete, commit_body, meta)
+	if err != nil {
 		return diag.Errorf("failed to commit file(s) to git: %s", err)
 	}
 
-	if _, err := gitCommand(checkout_dir, "push", "origin", "HEAD"); err != nil {
-		return diag.Errorf("failed to push commit")
+	push_diags, err := pushCommit(ctx, checkout_dir, commands, d, lease, meta)
+	if err != nil {
+		return gitDiagnostics(err, "failed to push commit")
 	}
-	return nil
+	return push_diags
+}
+
+// releaseFiles stops managing the files of old_files which are no longer in new_files, moves
+// the renamed ones and reverts the keys no longer patched, staging the changes in the checkout.
+// It returns the lines of the commit body and the moved files keyed by their previous path.
+func releaseFiles(ctx context.Context, checkout_dir string, old_files *schema.Set, new_files *schema.Set, config_contents map[string]string, on_destroy string,
+	old_original_files map[string]interface{}, old_original_values map[string]interface{}, defaults FileFormat) ([]string, map[string]interface{}, error) {
+	original_files := map_type.ToTypedObject(old_original_files)
+	managed := map[string]bool{}
+	blocks := map[string]*BlockMarkers{}
+	patches := map[string]*FilePatch{}
+	for _, v := range new_files.List() {
+		file := v.(map[string]interface{})
+		managed[file["filepath"].(string)] = true
+		blocks[file["filepath"].(string)] = fileBlock(file)
+		patches[file["filepath"].(string)] = filePatch(file)
+	}
+	renames := fileRenames(movableContents(fileContents(old_files), old_files, new_files),
+		movableContents(config_contents, old_files, new_files), on_destroy, old_original_files)
+	var updated_files []string
+	moved_files := map[string]interface{}{}
+
+	for _, v := range old_files.List() {
+		file := map_type.ToTypedObject(v.(map[string]interface{}))
+		filepath := file["filepath"]
+		if err := checkCheckoutPath(checkout_dir, filepath); err != nil {
+			return nil, nil, fmt.Errorf("failed to release file %s: %s", filepath, err)
+		}
+
+		if to, ok := renames[filepath]; ok {
+			moved_files[filepath] = to
+			if _, err := os.Lstat(path.Join(checkout_dir, filepath)); err != nil {
+				if os.IsNotExist(err) {
+					// already deleted outside of terraform, the new path is written below
+					continue
+				}
+				return nil, nil, fmt.Errorf("failed to move file %s: %s", filepath, err)
+			}
+			if err := os.MkdirAll(path.Dir(path.Join(checkout_dir, to)), 0755); err != nil {
+				return nil, nil, fmt.Errorf("failed to create file directory: %s", to)
+			}
+			// the new path is overwritten like any other managed file
+			if _, err := gitCommand(ctx, checkout_dir, "mv", "-f", "--", filepath, to); err != nil {
+				return nil, nil, fmt.Errorf("failed to move file %s to %s: %s", filepath, to, err)
+			}
+			updated_files = append(updated_files, fmt.Sprintf("%s -> %s", filepath, to))
+			continue
+		}
+
+		markers, patch := fileBlock(v.(map[string]interface{})), filePatch(v.(map[string]interface{}))
+		format := fileFormat(v.(map[string]interface{}), defaults)
+		var released string
+		var err error
+		if managed[filepath] && patch != nil && patches[filepath] != nil {
+			// the keys no longer patched are reverted, the patch is applied again below
+			keep := map[string]bool{}
+			for _, op := range patches[filepath].Set {
+				keep[patchKey(op)] = true
+			}
+			for _, pointer := range patches[filepath].Delete {
+				keep[pointer] = true
+			}
+			released, err = releasePatch(checkout_dir, filepath, *patch, format, fileOriginalValues(old_original_values, filepath), keep, false)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to release file %s: %s", filepath, err)
+			}
+		} else if managed[filepath] && markers != nil && blocks[filepath] != nil {
+			if *markers == *blocks[filepath] {
+				// the block is replaced in place below
+				continue
+			}
+			// the markers changed, the block is written again below
+			released, err = releaseBlock(checkout_dir, filepath, *markers, format, false)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to release file %s: %s", filepath, err)
+			}
+		} else if managed[filepath] {
+			// still managed, the file is written again below
+			if err := os.Remove(path.Join(checkout_dir, filepath)); err != nil {
+				if os.IsNotExist(err) {
+					// already deleted outside of terraform
+					continue
+				}
+				return nil, nil, fmt.Errorf("failed to delete file %s: %s", filepath, err)
+			}
+			released = ReleaseDeleted
+		} else {
+			released, err = releaseFile(ctx, checkout_dir, v.(map[string]interface{}), defaults, on_destroy, original_files[filepath], old_original_values)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to release file %s: %s", filepath, err)
+			}
+		}
+		if released == "" {
+			continue
+		}
+
+		if _, err := gitCommand(ctx, checkout_dir, "add", "--", filepath); err != nil {
+			return nil, nil, fmt.Errorf("failed to rm file in git: %s", filepath)
+		}
+
+		if released == ReleaseRestored {
+			updated_files = append(updated_files, fmt.Sprintf("< %s", filepath))
+		} else {
+			updated_files = append(updated_files, fmt.Sprintf("- %s", filepath))
+		}
+	}
+	return updated_files, moved_files, nil
+}
+
+// writeFiles writes the managed files into the checkout and stages them. It returns the lines of
+// the commit body and whether any file changed.
+func writeFiles(ctx context.Context, checkout_dir string, files *schema.Set, config_contents map[string]string, entries map[string]TreeEntry, defaults FileFormat) ([]string, bool, error) {
+	var updated_files []string
+	changed := false
+	for _, v := range files.List() {
+		file := map_type.ToTypedObject(v.(map[string]interface{}))
+		filepath := file["filepath"]
+		format := fileFormat(v.(map[string]interface{}), defaults)
+		contents := encodeContents(config_contents[filepath], format)
+
+		if entry, ok := entries[filepath]; ok && entry.Mode != regularFileMode {
+			// executables and symlinks are replaced by a regular file below
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("File mode changed: %s (%s)", filepath, entry.Mode))
+			if err := os.Remove(path.Join(checkout_dir, filepath)); err != nil && !os.IsNotExist(err) {
+				return nil, false, fmt.Errorf("failed to delete file %s: %s", filepath, err)
+			}
+		}
+		var err error
+		if markers := fileBlock(v.(map[string]interface{})); markers != nil {
+			if contents, err = writeBlock(checkout_dir, filepath, config_contents[filepath], *markers, format); err != nil {
+				return nil, false, fmt.Errorf("failed to write managed block of %s: %s", filepath, err)
+			}
+		}
+		if patch := filePatch(v.(map[string]interface{})); patch != nil {
+			if contents, err = writePatch(checkout_dir, filepath, *patch, format); err != nil {
+				return nil, false, fmt.Errorf("failed to patch %s: %s", filepath, err)
+			}
+		}
+
+		out, err := os.ReadFile(path.Join(checkout_dir, filepath))
+		if err != nil {
+			if os.IsNotExist(err) {
+				changed = true
+				if err := os.MkdirAll(path.Dir(path.Join(checkout_dir, filepath)), 0755); err != nil {
+					return nil, false, fmt.Errorf("failed to create file directory: %s", filepath)
+				}
+				if err := os.WriteFile(path.Join(checkout_dir, filepath), contents, 0666); err != nil {
+					return nil, false, fmt.Errorf("failed to create file: %s", filepath)
+				}
+				if _, err := gitCommand(ctx, checkout_dir, "add", "--", filepath); err != nil {
+					return nil, false, fmt.Errorf("failed to add file to git: %s", filepath)
+				}
+				updated_files = append(updated_files, fmt.Sprintf("+ %s", filepath))
+			} else {
+				updated_files = append(updated_files, fmt.Sprintf("? %s", filepath))
+			}
+			continue
+		}
+		if !bytes.Equal(out, contents) {
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("File contents changed: %s", filepath))
+			changed = true
+			if err := os.WriteFile(path.Join(checkout_dir, filepath), contents, 0666); err != nil {
+				return nil, false, fmt.Errorf("failed to update file: %s", filepath)
+			}
+			if _, err := gitCommand(ctx, checkout_dir, "add", "--", filepath); err != nil {
+				return nil, false, fmt.Errorf("failed to update file to git: %s", filepath)
+			}
+			updated_files = append(updated_files, fmt.Sprintf("~ %s", filepath))
+		}
+	}
+	return updated_files, changed, nil
 }
 
 func resourceUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -173,125 +1417,135 @@ func resourceUpdate(ctx context.Context, d *schema.ResourceData, meta interface{
 		azdoProject = v.(string)
 	}
 
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, "update", repo, azdoProject, branch, meta)
+	defer done()
+	unlock, err := lockBranch(ctx, commands, repo, azdoProject, branch, meta)
+	if err != nil {
+		return diag.Errorf("failed to lock branch %s: %s", branch, err)
+	}
+	defer unlock()
+
 	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
 	if err := os.MkdirAll(checkout_dir, 0755); err != nil {
 		return diag.Errorf("failed to create git temp dir: %s", err)
 	}
-	lockCheckout(checkout_dir)
 	defer func() {
-		unlockCheckout(checkout_dir)
 		_ = os.RemoveAll(checkout_dir)
 	}()
 
-	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
-
-	_, status, err := commands.checkout(checkout_dir, repo, branch, azdoProject)
+	_, status, err := commands.checkout(ctx, checkout_dir, repo, branch, azdoProject)
 	switch status {
 	case NotExist:
-		tflog.Warn(ctx, fmt.Sprintf("Branch not found for update: %s", branch))
+		tflog.SubsystemWarn(ctx, LogSubsystem, fmt.Sprintf("Branch not found for update: %s", branch))
 		d.SetId("")
 		return nil
 	case Exist:
-		tflog.Info(ctx, fmt.Sprintf("Branch exists for update: %s", branch))
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Branch exists for update: %s", branch))
 	case Unknown:
 		if err != nil {
-			return diag.Errorf("failed to checkout branch %s: %s", branch, repo)
+			return gitDiagnostics(err, fmt.Sprintf("failed to checkout branch %s of %s", branch, repo))
 		}
 	}
 
-	is_clean := true
+	filepaths := filePaths(d.Get("file").(*schema.Set))
+	diags := validateCheckout(checkout_dir, filepaths, meta)
+	if diags.HasError() {
+		return diags
+	}
+	config_contents := configContents(d)
+	if unknown := unknownContents(d.Get("file").(*schema.Set), config_contents); len(unknown) > 0 {
+		return diag.Errorf("failed to read the contents of %s from the config, only their hash is kept in state", strings.Join(unknown, ", "))
+	}
+	entries, err := commands.lsTree(ctx, checkout_dir, "HEAD", filepaths)
+	if err != nil {
+		return diag.Errorf("failed to list files in branch %s: %s", branch, err)
+	}
+
 	var updated_files []string
 	if d.HasChange("file") {
 		files, _ := d.GetChange("file")
-
-		for _, v := range files.(*schema.Set).List() {
-			file := map_type.ToTypedObject(v.(map[string]interface{}))
-			filepath := file["filepath"]
-
-			if err := os.Remove(path.Join(checkout_dir, filepath)); err != nil {
-				return diag.Errorf("failed to delete file %s: %s", filepath, err)
-			}
-
-			if _, err := gitCommand(checkout_dir, "add", "--", filepath); err != nil {
-				return diag.Errorf("failed to rm file in git: %s", filepath)
-			}
-
-			updated_files = append(updated_files, fmt.Sprintf("- %s", filepath))
+		original_files, _ := d.GetChange("original_files")
+		original_values, _ := d.GetChange("original_values")
+		released_files, moved_files, err := releaseFiles(ctx, checkout_dir, files.(*schema.Set), d.Get("file").(*schema.Set), config_contents,
+			d.Get("on_destroy").(string), original_files.(map[string]interface{}), original_values.(map[string]interface{}), meta.(*Owner).fileFormat)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		updated_files = append(updated_files, released_files...)
+		if err := d.Set("moved_files", moved_files); err != nil {
+			return diag.Errorf("failed to set moved files: %s", err)
 		}
 	}
+	if err := d.Set("original_files", originalFiles(d, entries)); err != nil {
+		return diag.Errorf("failed to set original files: %s", err)
+	}
+	original_values, err := originalValues(d, checkout_dir, meta.(*Owner).fileFormat)
+	if err != nil {
+		return diag.Errorf("failed to read patched keys: %s", err)
+	}
+	if err := d.Set("original_values", original_values); err != nil {
+		return diag.Errorf("failed to set original values: %s", err)
+	}
 
-	files := d.Get("file")
-	for _, v := range files.(*schema.Set).List() {
-		file := map_type.ToTypedObject(v.(map[string]interface{}))
-		filepath := file["filepath"]
-		contents := file["contents"]
-
-		var out []byte
-		var err error
-		if out, err = os.ReadFile(path.Join(checkout_dir, filepath)); err != nil {
-			if os.IsNotExist(err) {
-				is_clean = false
-				if err := os.MkdirAll(path.Dir(path.Join(checkout_dir, filepath)), 0755); err != nil {
-					return diag.Errorf("failed to create file directory: %s", filepath)
-				}
-				if err := os.WriteFile(path.Join(checkout_dir, filepath), []byte(contents), 0666); err != nil {
-					return diag.Errorf("failed to create file: %s", filepath)
-				}
-				if _, err := gitCommand(checkout_dir, "add", "--", filepath); err != nil {
-					return diag.Errorf("failed to add file to git: %s", filepath)
-				}
-				updated_files = append(updated_files, fmt.Sprintf("+ %s", filepath))
-			}
-			updated_files = append(updated_files, fmt.Sprintf("? %s", filepath))
-			continue
-		}
-		if string(out) != contents {
-			log.Printf("[INFO] File contents changed: %s", filepath)
-			is_clean = false
-			if err := os.WriteFile(path.Join(checkout_dir, filepath), []byte(contents), 0666); err != nil {
-				return diag.Errorf("failed to update file: %s", filepath)
-			}
-			if _, err := gitCommand(checkout_dir, "add", "--", filepath); err != nil {
-				return diag.Errorf("failed to update file to git: %s", filepath)
-			}
-			updated_files = append(updated_files, fmt.Sprintf("~ %s", filepath))
-		}
+	is_clean := len(updated_files) == 0
+	written_files, written, err := writeFiles(ctx, checkout_dir, d.Get("file").(*schema.Set), config_contents, entries, meta.(*Owner).fileFormat)
+	if err != nil {
+		return diag.FromErr(err)
 	}
+	updated_files = append(updated_files, written_files...)
+	is_clean = is_clean && !written
 
 	if is_clean {
 		var sha string
-		if out, err := gitCommand(checkout_dir, "rev-parse", "HEAD"); err != nil {
+		if out, err := gitCommand(ctx, checkout_dir, "rev-parse", "HEAD"); err != nil {
 			return diag.Errorf("failed to get revision")
 		} else {
 			sha = strings.TrimRight(string(out), "\n")
 		}
-		d.SetId(sha)
-		return nil
+		if err := setStateContents(d); err != nil {
+			return diag.Errorf("failed to set file contents: %s", err)
+		}
+		if err := setFileHashes(ctx, d, commands, checkout_dir); err != nil {
+			return diag.Errorf("failed to set file hashes: %s", err)
+		}
+		if err := setCommit(d, commands, sha, false); err != nil {
+			return diag.Errorf("failed to set commit: %s", err)
+		}
+		return diags
 	}
 
 	updated_files = set.GetSetFromStringArray(updated_files)
-	a := d.Get("author")
-	author := map_type.ToTypedObject(a.(map[string]interface{}))
-	commit_message := author["message"]
 	commit_body := fmt.Sprintf("The following files were updated by terraform:\n%s", strings.Join(updated_files, "\n"))
-	commit_command := flatten("commit", "-m", commit_message, "-m", commit_body, "--allow-empty")
-	commit_command = append(commit_command, commands.getAuthorString(author["name"], author["email"])...)
-	commit_command = append(commit_command, "--")
-	if _, err := gitCommand(checkout_dir, commit_command...); err != nil {
+	if check_diags := runPrePushChecks(ctx, checkout_dir, d); check_diags.HasError() {
+		return append(diags, check_diags...)
+	}
+	lease, err := commitChanges(ctx, checkout_dir, commands, d, CommitActionUpdate, commit_body, meta)
+	if err != nil {
 		return diag.Errorf("failed to commit file(s) to git: %s", err)
 	}
 
-	if _, err := gitCommand(checkout_dir, "push", "origin", "HEAD"); err != nil {
-		return diag.Errorf("failed to push commit")
+	push_diags, err := pushCommit(ctx, checkout_dir, commands, d, lease, meta)
+	if err != nil {
+		return gitDiagnostics(err, "failed to push commit")
 	}
+	diags = append(diags, push_diags...)
 	var sha string
-	if out, err := gitCommand(checkout_dir, "rev-parse", "HEAD"); err != nil {
+	if out, err := gitCommand(ctx, checkout_dir, "rev-parse", "HEAD"); err != nil {
 		return diag.Errorf("failed to get revision")
 	} else {
 		sha = strings.TrimRight(string(out), "\n")
 	}
-	d.SetId(sha)
-	return nil
+	if err := setStateContents(d); err != nil {
+		return diag.Errorf("failed to set file contents: %s", err)
+	}
+	if err := setFileHashes(ctx, d, commands, checkout_dir); err != nil {
+		return diag.Errorf("failed to set file hashes: %s", err)
+	}
+	if err := setCommit(d, commands, sha, true); err != nil {
+		return diag.Errorf("failed to set commit: %s", err)
+	}
+	return diags
 }
 
 func resourceCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -304,73 +1558,191 @@ func resourceCreate(ctx context.Context, d *schema.ResourceData, meta interface{
 		azdoProject = v.(string)
 	}
 
+	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, "create", repo, azdoProject, branch, meta)
+	defer done()
+	unlock, err := lockBranch(ctx, commands, repo, azdoProject, branch, meta)
+	if err != nil {
+		return diag.Errorf("failed to lock branch %s: %s", branch, err)
+	}
+	defer unlock()
+
 	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
 	if err := os.MkdirAll(checkout_dir, 0755); err != nil {
 		return diag.Errorf("failed to create git temp dir: %s", err)
 	}
-	lockCheckout(checkout_dir)
 	defer func() {
-		unlockCheckout(checkout_dir)
 		_ = os.RemoveAll(checkout_dir)
 	}()
 
-	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
-
-	_, status, err := commands.checkout(checkout_dir, repo, branch, azdoProject)
+	branch_created := false
+	base_sha := ""
+	_, status, err := commands.checkout(ctx, checkout_dir, repo, branch, azdoProject)
 	switch status {
 	case NotExist:
-		tflog.Warn(ctx, fmt.Sprintf("Branch not found for create: %s", branch))
-		return diag.Errorf("Branch not found for create %s: %s", branch, repo)
+		tflog.SubsystemWarn(ctx, LogSubsystem, fmt.Sprintf("Branch not found for create: %s", branch))
+		if !d.Get("create_branch").(bool) {
+			return gitDiagnostics(err, fmt.Sprintf("branch %s not found in %s, set create_branch to create it", branch, repo))
+		}
+		base_ref := d.Get("base_ref").(string)
+		base_sha, err = commands.createBranch(ctx, checkout_dir, branch, base_ref)
+		if err != nil {
+			return gitDiagnostics(err, fmt.Sprintf("failed to create branch %s from %s", branch, base_ref))
+		}
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Created branch %s from %s", branch, base_sha))
+		branch_created = true
 	case Exist:
-		tflog.Info(ctx, fmt.Sprintf("Branch exists for update: %s", branch))
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Branch exists for update: %s", branch))
 	case Unknown:
 		if err != nil {
-			return diag.Errorf("failed to checkout branch %s: %s", branch, repo)
+			return gitDiagnostics(err, fmt.Sprintf("failed to checkout branch %s of %s", branch, repo))
+		}
+	}
+
+	filepaths := filePaths(d.Get("file").(*schema.Set))
+	diags := validateCheckout(checkout_dir, filepaths, meta)
+	if diags.HasError() {
+		return diags
+	}
+	config_contents := configContents(d)
+	entries := map[string]TreeEntry{}
+	if !branch_created || base_sha != "" {
+		// a branch created in an empty repository has no commit to list yet
+		entries, err = commands.lsTree(ctx, checkout_dir, "HEAD", filepaths)
+		if err != nil {
+			return diag.Errorf("failed to list files in branch %s: %s", branch, err)
+		}
+	}
+	overwrite := d.Get("overwrite_on_create").(string)
+	original_files := originalFiles(d, entries)
+	if overwrite != OverwriteTrue {
+		var conflicts []string
+		for _, v := range d.Get("file").(*schema.Set).List() {
+			file := map_type.ToTypedObject(v.(map[string]interface{}))
+			entry, ok := entries[file["filepath"]]
+			if !ok {
+				continue
+			}
+			if filePatch(v.(map[string]interface{})) != nil {
+				// only the patched keys belong to terraform
+				continue
+			}
+			format := fileFormat(v.(map[string]interface{}), meta.(*Owner).fileFormat)
+			if markers := fileBlock(v.(map[string]interface{})); markers != nil {
+				// only the block belongs to terraform, the rest of the file is left as is
+				out, err := os.ReadFile(path.Join(checkout_dir, entry.Path))
+				if err != nil {
+					continue
+				}
+				if found, matches := blockMatches(out, config_contents[entry.Path], *markers, format); found && !matches {
+					conflicts = append(conflicts, fmt.Sprintf("%s (%s)", entry.Path, entry.Sha))
+				}
+				continue
+			}
+			contents := encodeContents(config_contents[file["filepath"]], format)
+			if entry.Sha != gitBlobSha(string(contents)) {
+				conflicts = append(conflicts, fmt.Sprintf("%s (%s)", entry.Path, entry.Sha))
+			} else if overwrite == OverwriteAdopt {
+				tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Adopting existing file: %s", entry.Path))
+				original_files[entry.Path] = ""
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return diag.Diagnostics{{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("Files already exist in branch %s", branch),
+				Detail: fmt.Sprintf("The following files already exist in branch %s of %s with different content:\n%s\n\n"+
+					"Set overwrite_on_create = true to overwrite them, or import them first.", branch, repo, strings.Join(conflicts, "\n")),
+				AttributePath: cty.GetAttrPath("file"),
+			}}
 		}
 	}
+	if err := d.Set("original_files", original_files); err != nil {
+		return diag.Errorf("failed to set original files: %s", err)
+	}
+	original_values, err := originalValues(d, checkout_dir, meta.(*Owner).fileFormat)
+	if err != nil {
+		return diag.Errorf("failed to read patched keys: %s", err)
+	}
+	if err := d.Set("original_values", original_values); err != nil {
+		return diag.Errorf("failed to set original values: %s", err)
+	}
+	if err := d.Set("branch_created", branch_created); err != nil {
+		return diag.Errorf("failed to set branch created: %s", err)
+	}
+	if err := d.Set("moved_files", map[string]interface{}{}); err != nil {
+		return diag.Errorf("failed to set moved files: %s", err)
+	}
 
 	var added_files []string
 	files := d.Get("file")
 	for _, v := range files.(*schema.Set).List() {
 		file := map_type.ToTypedObject(v.(map[string]interface{}))
 		filepath := file["filepath"]
-		contents := file["contents"]
+		format := fileFormat(v.(map[string]interface{}), meta.(*Owner).fileFormat)
+		contents := encodeContents(config_contents[filepath], format)
 
+		if entry, ok := entries[filepath]; ok && entry.Mode != regularFileMode {
+			// never write through symlinks
+			if err := os.Remove(path.Join(checkout_dir, filepath)); err != nil && !os.IsNotExist(err) {
+				return diag.Errorf("failed to delete file %s: %s", filepath, err)
+			}
+		}
+		if markers := fileBlock(v.(map[string]interface{})); markers != nil {
+			if contents, err = writeBlock(checkout_dir, filepath, config_contents[filepath], *markers, format); err != nil {
+				return diag.Errorf("failed to write managed block of %s: %s", filepath, err)
+			}
+		}
+		if patch := filePatch(v.(map[string]interface{})); patch != nil {
+			if contents, err = writePatch(checkout_dir, filepath, *patch, format); err != nil {
+				return diag.Errorf("failed to patch %s: %s", filepath, err)
+			}
+		}
 		if err := os.MkdirAll(path.Dir(path.Join(checkout_dir, filepath)), 0755); err != nil {
 			return diag.Errorf("failed to create file directory: %s", filepath)
 		}
-		if err := os.WriteFile(path.Join(checkout_dir, filepath), []byte(contents), 0666); err != nil {
+		if err := os.WriteFile(path.Join(checkout_dir, filepath), contents, 0666); err != nil {
 			return diag.Errorf("failed to create file: %s", filepath)
 		}
 
-		if _, err := gitCommand(checkout_dir, "add", "--", filepath); err != nil {
+		if _, err := gitCommand(ctx, checkout_dir, "add", "--", filepath); err != nil {
 			return diag.Errorf("failed to add file to git: %s", filepath)
 		}
 		added_files = append(added_files, filepath)
 	}
 
-	a := d.Get("author")
-	author := map_type.ToTypedObject(a.(map[string]interface{}))
-	commit_message := author["message"]
 	commit_body := fmt.Sprintf("The following files were created by terraform:\n%s", strings.Join(added_files, "\n"))
-	commit_command := flatten("commit", "-m", commit_message, "-m", commit_body, "--allow-empty")
-	commit_command = append(commit_command, commands.getAuthorString(author["name"], author["email"])...)
-	if _, err := gitCommand(checkout_dir, commit_command...); err != nil {
+	if check_diags := runPrePushChecks(ctx, checkout_dir, d); check_diags.HasError() {
+		return append(diags, check_diags...)
+	}
+	lease, err := commitChanges(ctx, checkout_dir, commands, d, CommitActionCreate, commit_body, meta)
+	if err != nil {
 		return diag.Errorf("failed to commit file(s) to git: %s", err)
 	}
 
-	if _, err := gitCommand(checkout_dir, "push", "origin", "HEAD"); err != nil {
-		return diag.Errorf("failed to push commit")
+	push_diags, err := pushCommit(ctx, checkout_dir, commands, d, lease, meta)
+	if err != nil {
+		return gitDiagnostics(err, "failed to push commit")
 	}
+	diags = append(diags, push_diags...)
 
 	var sha string
-	if out, err := gitCommand(checkout_dir, "rev-parse", "HEAD"); err != nil {
+	if out, err := gitCommand(ctx, checkout_dir, "rev-parse", "HEAD"); err != nil {
 		return diag.Errorf("failed to get revision")
 	} else {
 		sha = strings.TrimRight(string(out), "\n")
 	}
-	d.SetId(sha)
-	return nil
+	if err := setStateContents(d); err != nil {
+		return diag.Errorf("failed to set file contents: %s", err)
+	}
+	if err := setFileHashes(ctx, d, commands, checkout_dir); err != nil {
+		return diag.Errorf("failed to set file hashes: %s", err)
+	}
+	if err := setCommit(d, commands, sha, true); err != nil {
+		return diag.Errorf("failed to set commit: %s", err)
+	}
+	return diags
 }
 
 func resourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -383,29 +1755,27 @@ func resourceRead(ctx context.Context, d *schema.ResourceData, meta interface{})
 		azdoProject = v.(string)
 	}
 
-	checkout_dir := path.Join(os.TempDir(), unique.UniqueId())
-	if err := os.MkdirAll(checkout_dir, 0755); err != nil {
-		return diag.Errorf("failed to create git temp dir: %s", err)
-	}
-	lockCheckout(checkout_dir)
-	defer func() {
-		unlockCheckout(checkout_dir)
-		_ = os.RemoveAll(checkout_dir)
-	}()
-
 	commands := NewGitCommands(meta.(*Owner).name, meta.(*Owner).token, org, hostname)
+	ctx, done := logOperation(ctx, commands, "read", repo, azdoProject, branch, meta)
+	defer done()
+	unlock, err := lockBranch(ctx, commands, repo, azdoProject, branch, meta)
+	if err != nil {
+		return diag.Errorf("failed to lock branch %s: %s", branch, err)
+	}
+	defer unlock()
 
-	rev, status, err := commands.checkout(checkout_dir, repo, branch, azdoProject)
+	checkout_dir, rev, status, release, err := meta.(*Owner).checkouts.checkout(ctx, commands, repo, branch, azdoProject)
+	defer release()
 	switch status {
 	case Unknown:
 		if err != nil {
-			return diag.Errorf("failed to checkout branch %s: %s", branch, repo)
+			return gitDiagnostics(err, fmt.Sprintf("failed to checkout branch %s of %s", branch, repo))
 		}
 	case Exist:
-		log.Printf("[INFO] branch: %s (HEAD): %s", branch, rev)
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("branch: %s (HEAD): %s", branch, rev))
 	case NotExist:
-		force := d.Get("force_new").(bool)
-		tflog.Warn(ctx, fmt.Sprintf("failed to find remote branch: %s", branch))
+		force := d.Get("force_new").(bool) || d.Get("create_branch").(bool)
+		tflog.SubsystemWarn(ctx, LogSubsystem, fmt.Sprintf("failed to find remote branch: %s", branch))
 		if force {
 			// this will create the resource, ignores ignore_changes
 			d.SetId("")
@@ -415,49 +1785,64 @@ func resourceRead(ctx context.Context, d *schema.ResourceData, meta interface{})
 		return nil
 	}
 
-	files := d.Get("file")
-	clean_files := d.Get("file")
-	is_clean := true
-	for _, v := range files.(*schema.Set).List() {
+	files := d.Get("file").(*schema.Set).List()
+	filepaths := filePaths(d.Get("file").(*schema.Set))
+	entries, err := commands.lsTree(ctx, checkout_dir, "HEAD", filepaths)
+	if err != nil {
+		return diag.Errorf("failed to list files in branch %s: %s", branch, err)
+	}
+
+	var diags diag.Diagnostics
+	recorded_hashes := d.Get("file_hashes").(map[string]interface{})
+	previous_drift := d.Get("drifted_files").(map[string]interface{})
+	file_hashes := map[string]interface{}{}
+	drifted_files := map[string]interface{}{}
+	for _, v := range files {
 		file := map_type.ToTypedObject(v.(map[string]interface{}))
 		filepath := file["filepath"]
-		contents := file["contents"]
 
-		var out []byte
-		var err error
-		if out, err = os.ReadFile(path.Join(checkout_dir, filepath)); err != nil {
-			if os.IsNotExist(err) {
-				log.Printf("[INFO] Expected file doesn't exist: %s", filepath)
-				clean_files.(*schema.Set).Remove(v)
-			}
-			is_clean = false
-			log.Printf("[WARN] Expected file missing in branch: %s", filepath)
-		}
-		if string(out) != contents {
-			log.Printf("[INFO] File contents changed: %s", filepath)
-			is_clean = false
-			clean_files.(*schema.Set).Remove(v)
+		var entry *TreeEntry
+		if e, ok := entries[filepath]; ok {
+			entry = &e
+			file_hashes[filepath] = e.Sha
+		} else {
+			file_hashes[filepath] = ""
 		}
-	}
 
-	if !is_clean {
-		err := d.Set("file", clean_files)
-		if err != nil {
-			return diag.Errorf("failed to set git files: %s", err)
+		recorded_sha, _ := recorded_hashes[filepath].(string)
+		if _, ok := previous_drift[filepath]; ok {
+			// the recorded SHA is the drifted one
+			recorded_sha = ""
+		}
+		if drift := fileDrift(checkout_dir, v.(map[string]interface{}), meta.(*Owner).fileFormat, entry, recorded_sha); drift != "" {
+			tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("File changed outside of terraform: %s (%s)", filepath, drift))
+			drifted_files[filepath] = drift
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Managed file %s changed outside of Terraform", filepath),
+				Detail:   fmt.Sprintf("The file %s in branch %s of %s was changed outside of Terraform: %s", filepath, branch, repo, drift),
+			})
 		}
-		return nil
 	}
 
-	current_id := d.Id()
-	log.Printf("[INFO] Current branch revision: %s", current_id)
-	log.Printf("[INFO] Actual branch revision: %s", rev)
-
-	if current_id != rev {
-		log.Printf("[INFO] Remote revision not the same as local revision: %s <-> %s", rev, current_id)
-		d.SetId(rev)
-		return nil
+	if err := d.Set("file_hashes", file_hashes); err != nil {
+		return diag.Errorf("failed to set file hashes: %s", err)
+	}
+	if err := d.Set("drifted_files", drifted_files); err != nil {
+		return diag.Errorf("failed to set drifted files: %s", err)
+	}
+	if err := d.Set("planned_diff", map[string]interface{}{}); err != nil {
+		return diag.Errorf("failed to set planned diff: %s", err)
+	}
+	if err := setBlobShas(d, entries); err != nil {
+		return diag.Errorf("failed to set blob SHAs: %s", err)
 	}
 
-	d.SetId(current_id)
-	return nil
+	if head := d.Get("branch_head_sha").(string); head != rev {
+		tflog.SubsystemInfo(ctx, LogSubsystem, fmt.Sprintf("Remote revision not the same as local revision: %s <-> %s", rev, head))
+	}
+	if err := d.Set("branch_head_sha", rev); err != nil {
+		return diag.Errorf("failed to set branch head: %s", err)
+	}
+	return diags
 }
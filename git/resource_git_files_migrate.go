@@ -0,0 +1,247 @@
+package git
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceGitFilesV0 is the git_files schema before contents_in_state was added to file blocks.
+// The schemas of earlier versions are frozen, only the types matter to read their state.
+func resourceGitFilesV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"author": {
+				Type:     schema.TypeMap,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"branch": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"repository": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"organization": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"project": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"force_new": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"create_branch": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"base_ref": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"delete_branch_on_destroy": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"branch_created": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"restore_drift": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"overwrite_on_create": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"original_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"file_hashes": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drifted_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"moved_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"file": {
+				Type:     schema.TypeSet,
+				Required: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"filepath": {Type: schema.TypeString, Required: true},
+						"contents": {Type: schema.TypeString, Required: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+// resourceGitFilesV1 is the git_files schema when the ID was the SHA of the branch head.
+func resourceGitFilesV1() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"author": {
+				Type:     schema.TypeMap,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"branch": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"repository": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"organization": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"project": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"force_new": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"create_branch": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"base_ref": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"delete_branch_on_destroy": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"branch_created": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"restore_drift": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"overwrite_on_create": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"original_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"file_hashes": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drifted_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"moved_files": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"file": {
+				Type:     schema.TypeSet,
+				Required: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"filepath":          {Type: schema.TypeString, Required: true},
+						"contents":          {Type: schema.TypeString, Required: true},
+						"contents_in_state": {Type: schema.TypeString, Optional: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+// resourceGitFilesStateUpgradeV0 keeps the full contents of files managed before
+// contents_in_state was added, without showing a change for every file block.
+func resourceGitFilesStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	files, _ := rawState["file"].([]interface{})
+	for _, v := range files {
+		file, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if mode, _ := file["contents_in_state"].(string); mode == "" {
+			file["contents_in_state"] = ContentsFull
+		}
+	}
+	return rawState, nil
+}
+
+// resourceGitFilesStateUpgradeV1 replaces the branch head SHA used as ID by the composite ID of
+// the repository, branch and managed paths. The SHA is kept as branch_head_sha, commit_sha is
+// only known after the next commit of the resource.
+func resourceGitFilesStateUpgradeV1(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	id, _ := rawState["id"].(string)
+	if id == "" || id == "-1" {
+		// the branch is missing, the resource is created again
+		return rawState, nil
+	}
+
+	var filepaths []string
+	files, _ := rawState["file"].([]interface{})
+	for _, v := range files {
+		file, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected file block in state: %v", v)
+		}
+		filepath, _ := file["filepath"].(string)
+		filepaths = append(filepaths, filepath)
+	}
+	hostname, _ := rawState["hostname"].(string)
+	org, _ := rawState["organization"].(string)
+	project, _ := rawState["project"].(string)
+	repo, _ := rawState["repository"].(string)
+	branch, _ := rawState["branch"].(string)
+
+	rawState["branch_head_sha"] = id
+	rawState["id"] = resourceId(hostname, org, project, repo, branch, filepaths)
+	return rawState, nil
+}
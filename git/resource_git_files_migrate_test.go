@@ -0,0 +1,92 @@
+package git
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	ctyjson "github.com/hashicorp/go-cty/cty/json"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestResourceGitFilesStateUpgradeV0(t *testing.T) {
+	v0 := map[string]interface{}{
+		"id":     "4f1d2a6",
+		"branch": "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "a.txt", "contents": "a"},
+		},
+	}
+	expected := map[string]interface{}{
+		"id":     "4f1d2a6",
+		"branch": "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "a.txt", "contents": "a", "contents_in_state": ContentsFull},
+		},
+	}
+
+	actual, err := resourceGitFilesStateUpgradeV0(context.Background(), v0, nil)
+	if err != nil {
+		t.Fatalf("error migrating state: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestResourceGitFilesStateUpgradeV1(t *testing.T) {
+	v1 := map[string]interface{}{
+		"id":           "4f1d2a6",
+		"hostname":     "github.com",
+		"organization": "go-pax",
+		"repository":   "terraform-provider-git",
+		"branch":       "main",
+		"file": []interface{}{
+			map[string]interface{}{"filepath": "a.txt", "contents": "a", "contents_in_state": ContentsFull},
+		},
+	}
+
+	actual, err := resourceGitFilesStateUpgradeV1(context.Background(), v1, nil)
+	if err != nil {
+		t.Fatalf("error migrating state: %s", err)
+	}
+	expected_id := resourceId("github.com", "go-pax", "", "terraform-provider-git", "main", []string{"a.txt"})
+	if actual["id"] != expected_id {
+		t.Errorf("expected ID %s, got %v", expected_id, actual["id"])
+	}
+	if actual["branch_head_sha"] != "4f1d2a6" {
+		t.Errorf("expected branch_head_sha 4f1d2a6, got %v", actual["branch_head_sha"])
+	}
+
+	missing := map[string]interface{}{"id": "-1"}
+	if actual, err := resourceGitFilesStateUpgradeV1(context.Background(), missing, nil); err != nil || actual["id"] != "-1" {
+		t.Errorf("expected the ID of a missing branch to be kept, got %v (%v)", actual["id"], err)
+	}
+}
+
+func TestResourceGitFilesFrozenSchemas(t *testing.T) {
+	for version, r := range []*schema.Resource{resourceGitFilesV0(), resourceGitFilesV1()} {
+		for _, k := range []string{"commit_sha", "commit_url", "branch_head_sha", "planned_diff", "commit_mode", "pre_push_check"} {
+			if _, ok := r.Schema[k]; ok {
+				t.Errorf("V%d: unexpected attribute %s added after the version", version, k)
+			}
+		}
+		file := r.Schema["file"].Elem.(*schema.Resource).Schema
+		if _, ok := file["blob_sha"]; ok {
+			t.Errorf("V%d: unexpected file attribute blob_sha added after the version", version)
+		}
+		if _, ok := file["contents_in_state"]; ok != (version == 1) {
+			t.Errorf("V%d: contents_in_state is only part of V1", version)
+		}
+		if err := r.InternalValidate(nil, true); err != nil {
+			t.Errorf("V%d: %s", version, err)
+		}
+	}
+
+	// state written by V0 decodes with its schema
+	state := `{"id":"4f1d2a6","author":{"name":"a"},"branch":"main","hostname":"github.com","repository":"repo",` +
+		`"organization":"org","file":[{"filepath":"a.txt","contents":"a"}],"original_files":{"a.txt":""}}`
+	if _, err := ctyjson.Unmarshal([]byte(state), resourceGitFilesV0().CoreConfigSchema().ImpliedType()); err != nil {
+		t.Errorf("failed to decode V0 state: %s", err)
+	}
+}
@@ -1,11 +1,15 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
@@ -358,3 +362,200 @@ func TestAccGitFileResource(t *testing.T) {
 
 	})*/
 }
+
+func TestResourceCreateExistingFiles(t *testing.T) {
+	cases := []struct {
+		name      string
+		overwrite string
+		contents  string
+		conflict  bool
+		original  string
+	}{
+		{"different contents", OverwriteFalse, "changed\n", true, ""},
+		{"same contents", OverwriteFalse, "hello\n", false, gitBlobSha("hello\n")},
+		{"overwritten", OverwriteTrue, "changed\n", false, gitBlobSha("hello\n")},
+		{"adopted", OverwriteAdopt, "hello\n", false, ""},
+		{"not adopted with different contents", OverwriteAdopt, "changed\n", true, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			remote, meta := testRemote(t)
+			d := schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+				"hostname":            "example.com",
+				"organization":        "org",
+				"repository":          "repo",
+				"branch":              "main",
+				"overwrite_on_create": c.overwrite,
+				"file": []interface{}{
+					map[string]interface{}{"filepath": "a.txt", "contents": c.contents},
+					map[string]interface{}{"filepath": "b.txt", "contents": "new\n"},
+				},
+			})
+			diags := resourceCreate(context.Background(), d, meta)
+			if c.conflict {
+				if !diags.HasError() || !strings.Contains(diags[0].Detail, "a.txt ("+gitBlobSha("hello\n")+")") {
+					t.Fatalf("expected a conflict on a.txt, got %v", diags)
+				}
+				if actual := testRemoteFile(t, remote, "main", "a.txt"); actual != "hello\n" {
+					t.Errorf("expected a.txt to be left as is, got %q", actual)
+				}
+				if actual := testRemoteFile(t, remote, "main", "b.txt"); actual != "" {
+					t.Errorf("expected nothing to be pushed, got b.txt %q", actual)
+				}
+				return
+			}
+			if diags.HasError() {
+				t.Fatalf("unexpected error: %v", diags)
+			}
+			if actual := testRemoteFile(t, remote, "main", "a.txt"); actual != c.contents {
+				t.Errorf("expected a.txt %q, got %q", c.contents, actual)
+			}
+			original_files := d.Get("original_files").(map[string]interface{})
+			if original_files["a.txt"] != c.original || original_files["b.txt"] != "" {
+				t.Errorf("expected the original a.txt %q and no original b.txt, got %v", c.original, original_files)
+			}
+		})
+	}
+}
+
+func TestReleaseFiles(t *testing.T) {
+	cases := []struct {
+		name       string
+		on_destroy string
+		original   string
+		current    string
+		body       []string
+		expected   string
+		err        string
+	}{
+		{"deleted", OnDestroyDelete, gitBlobSha("original\n"), "managed\n", []string{"- a.txt"}, "", ""},
+		{"deleted after a change", OnDestroyDelete, "", "changed\n", []string{"- a.txt"}, "", ""},
+		{"already deleted", OnDestroyDelete, "", "", nil, "", ""},
+		{"retained", OnDestroyRetain, gitBlobSha("original\n"), "managed\n", nil, "managed\n", ""},
+		{"restored", OnDestroyRestore, gitBlobSha("original\n"), "managed\n", []string{"< a.txt"}, "original\n", ""},
+		{"restored after a change", OnDestroyRestore, gitBlobSha("original\n"), "changed\n", []string{"< a.txt"}, "original\n", ""},
+		{"created by terraform", OnDestroyRestore, "", "managed\n", []string{"- a.txt"}, "", ""},
+		{"original blob gone", OnDestroyRestore, gitBlobSha("gone\n"), "managed\n", nil, "managed\n", "failed to read original content of a.txt"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			git := func(args ...string) string {
+				out, err := gitCommand(ctx, dir, append([]string{"-c", "user.name=a", "-c", "user.email=a@x"}, args...)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(out)
+			}
+			commit := func(contents string) {
+				if contents == "" {
+					git("rm", "-q", "a.txt")
+				} else {
+					if err := os.WriteFile(path.Join(dir, "a.txt"), []byte(contents), 0666); err != nil {
+						t.Fatal(err)
+					}
+					git("add", "-A")
+				}
+				git("commit", "-qm", "commit "+contents)
+			}
+			git("init", "-q")
+			commit("original\n")
+			commit("managed\n")
+			if c.current != "managed\n" {
+				commit(c.current)
+			}
+
+			old_files := schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+				"repository": "repo",
+				"branch":     "main",
+				"file": []interface{}{
+					map[string]interface{}{"filepath": "a.txt", "contents": "managed\n"},
+				},
+			}).Get("file").(*schema.Set)
+			body, _, err := releaseFiles(ctx, dir, old_files, schema.NewSet(old_files.F, nil), map[string]string{}, c.on_destroy,
+				map[string]interface{}{"a.txt": c.original}, map[string]interface{}{}, FileFormat{})
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if strings.Join(body, "\n") != strings.Join(c.body, "\n") {
+				t.Errorf("expected body %q, got %q", c.body, body)
+			}
+
+			contents, err := os.ReadFile(path.Join(dir, "a.txt"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(contents) != c.expected {
+				t.Errorf("expected a.txt %q, got %q", c.expected, contents)
+			}
+			staged := strings.TrimSpace(git("diff", "--cached", "--name-status"))
+			if changed := string(contents) != c.current; changed != (staged != "") {
+				t.Errorf("expected the change of a.txt to be staged, got %q", staged)
+			}
+		})
+	}
+}
+
+func TestFileDrift(t *testing.T) {
+	dir := t.TempDir()
+	write := func(filepath string, contents string) {
+		if err := os.WriteFile(path.Join(dir, filepath), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("same.txt", "a\n")
+	write("crlf.txt", "a\r\n")
+	write("changed.txt", "b\n")
+	write("block.txt", "human\n# BEGIN TERRAFORM MANAGED BLOCK\nb\n# END TERRAFORM MANAGED BLOCK\n")
+	write("no_block.txt", "human\n")
+	write("app.json", `{"port": 80, "name": "app"}`)
+
+	recorded := gitBlobSha("a\n")
+	block := map[string]interface{}{"managed_block": true}
+	patch := map[string]interface{}{"patch": []interface{}{
+		map[string]interface{}{"set": []interface{}{map[string]interface{}{"path": "/port", "value": "8080"}}},
+	}}
+	cases := []struct {
+		filepath string
+		options  map[string]interface{}
+		entry    *TreeEntry
+		expected string
+	}{
+		{"same.txt", nil, &TreeEntry{Mode: regularFileMode, Sha: recorded}, ""},
+		// still at the recorded SHA, whatever git did to the file on checkout
+		{"crlf.txt", nil, &TreeEntry{Mode: regularFileMode, Sha: recorded}, ""},
+		{"same.txt", nil, &TreeEntry{Mode: regularFileMode, Sha: gitBlobSha("other\n")}, ""},
+		{"changed.txt", nil, &TreeEntry{Mode: regularFileMode, Sha: gitBlobSha("b\n")}, DriftModified},
+		{"missing.txt", nil, &TreeEntry{Mode: regularFileMode, Sha: gitBlobSha("b\n")}, DriftModified},
+		{"missing.txt", nil, nil, DriftDeleted},
+		{"same.txt", nil, &TreeEntry{Mode: "100755", Sha: recorded}, DriftModeChanged},
+		{"changed.txt", nil, &TreeEntry{Mode: "100755", Sha: gitBlobSha("b\n")}, DriftModified + "," + DriftModeChanged},
+		{"block.txt", block, &TreeEntry{Mode: regularFileMode, Sha: "changed"}, DriftModified},
+		{"no_block.txt", block, &TreeEntry{Mode: regularFileMode, Sha: "changed"}, DriftDeleted},
+		{"app.json", patch, &TreeEntry{Mode: regularFileMode, Sha: "changed"}, DriftModified},
+	}
+	for _, c := range cases {
+		file := map[string]interface{}{"filepath": c.filepath, "contents": "a\n"}
+		for k, v := range c.options {
+			file[k] = v
+		}
+		if actual := fileDrift(dir, file, FileFormat{}, c.entry, recorded); actual != c.expected {
+			t.Errorf("fileDrift(%s, %+v): expected %q, got %q", c.filepath, c.entry, c.expected, actual)
+		}
+	}
+
+	// the patched keys still have their value
+	write("app.json", `{"port": 8080, "name": "renamed"}`)
+	file := map[string]interface{}{"filepath": "app.json", "contents": ""}
+	for k, v := range patch {
+		file[k] = v
+	}
+	if actual := fileDrift(dir, file, FileFormat{}, &TreeEntry{Mode: regularFileMode, Sha: "changed"}, recorded); actual != "" {
+		t.Errorf("expected no drift of the patched keys, got %q", actual)
+	}
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// skipCi returns how the host of the repository is told not to run pipelines for a commit.
+func skipCi(hostname string) SkipCi {
+	switch {
+	case isAzureDevOps(hostname):
+		// Azure Pipelines looks for its own marker
+		return SkipCi{Marker: "***NO_CI***"}
+	case hostname == "gitlab.com" || strings.HasPrefix(hostname, "gitlab."):
+		// a push option skips the pipeline of this push only, a marker would stick to the commit
+		return SkipCi{PushOptions: []string{"ci.skip"}}
+	case hostname == "github.com":
+		// the trailer skips the checks of GitHub Apps, the marker the Actions workflows
+		return SkipCi{Marker: "[skip ci]", Trailers: []string{"skip-checks: true"}}
+	}
+	return SkipCi{Marker: "[skip ci]"}
+}
+
+// pushFlags returns the flags of every push of the resource, skipping the hooks unless they run
+// and passing the push options.
+func pushFlags(d *schema.ResourceData) []string {
+	var flags []string
+	if !d.Get("run_repo_hooks").(bool) {
+		flags = append(flags, "--no-verify")
+	}
+	push_options := []string{}
+	for _, v := range d.Get("push_options").([]interface{}) {
+		push_options = append(push_options, v.(string))
+	}
+	if d.Get("skip_ci").(bool) {
+		push_options = append(push_options, skipCi(d.Get("hostname").(string)).PushOptions...)
+	}
+	for _, push_option := range push_options {
+		flags = append(flags, "--push-option="+push_option)
+	}
+	return flags
+}
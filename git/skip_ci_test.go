@@ -0,0 +1,37 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestSkipCi(t *testing.T) {
+	cases := map[string]SkipCi{
+		"github.com":           {Marker: "[skip ci]", Trailers: []string{"skip-checks: true"}},
+		"gitlab.com":           {PushOptions: []string{"ci.skip"}},
+		"gitlab.example.com":   {PushOptions: []string{"ci.skip"}},
+		"dev.azure.com":        {Marker: "***NO_CI***"},
+		"org.visualstudio.com": {Marker: "***NO_CI***"},
+		"bitbucket.org":        {Marker: "[skip ci]"},
+	}
+	for hostname, expected := range cases {
+		if actual := skipCi(hostname); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("skipCi(%s): expected %+v, got %+v", hostname, expected, actual)
+		}
+	}
+}
+
+func TestPushFlags(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceGitFilesSchema(), map[string]interface{}{
+		"hostname":       "gitlab.com",
+		"run_repo_hooks": false,
+		"push_options":   []interface{}{"merge_request.create", "merge_request.target=main"},
+		"skip_ci":        true,
+	})
+	expected := []string{"--no-verify", "--push-option=merge_request.create", "--push-option=merge_request.target=main", "--push-option=ci.skip"}
+	if actual := pushFlags(d); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// validateStringInSlice returns a SchemaValidateDiagFunc which checks that the value is one of valid.
+func validateStringInSlice(valid []string) schema.SchemaValidateDiagFunc {
+	return func(i interface{}, p cty.Path) diag.Diagnostics {
+		v, ok := i.(string)
+		if !ok {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Expected a string",
+				AttributePath: p,
+			}}
+		}
+		for _, s := range valid {
+			if v == s {
+				return nil
+			}
+		}
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("Unexpected value %q", v),
+			Detail:        fmt.Sprintf("Expected one of %s.", strings.Join(valid, ", ")),
+			AttributePath: p,
+		}}
+	}
+}
+
+// validateIntAtLeast returns a SchemaValidateDiagFunc which checks that the value is at least min.
+func validateIntAtLeast(min int) schema.SchemaValidateDiagFunc {
+	return func(i interface{}, p cty.Path) diag.Diagnostics {
+		v, ok := i.(int)
+		if !ok {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Expected an integer",
+				AttributePath: p,
+			}}
+		}
+		if v < min {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Unexpected value %d", v),
+				Detail:        fmt.Sprintf("Expected a value of at least %d.", min),
+				AttributePath: p,
+			}}
+		}
+		return nil
+	}
+}
+
+// validateDuration checks that the value is a duration parsed by time.ParseDuration, e.g. `30s`.
+func validateDuration(i interface{}, p cty.Path) diag.Diagnostics {
+	v, ok := i.(string)
+	if !ok {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Expected a string",
+			AttributePath: p,
+		}}
+	}
+	if d, err := time.ParseDuration(v); err != nil || d < 0 {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("Unexpected value %q", v),
+			Detail:        "Expected a duration such as 30s or 10m.",
+			AttributePath: p,
+		}}
+	}
+	return nil
+}
+
+// validateStringContains returns a SchemaValidateDiagFunc which checks that the value contains substr.
+func validateStringContains(substr string) schema.SchemaValidateDiagFunc {
+	return func(i interface{}, p cty.Path) diag.Diagnostics {
+		v, ok := i.(string)
+		if !ok {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Expected a string",
+				AttributePath: p,
+			}}
+		}
+		if !strings.Contains(v, substr) {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Unexpected value %q", v),
+				Detail:        fmt.Sprintf("Expected a value containing %s.", substr),
+				AttributePath: p,
+			}}
+		}
+		return nil
+	}
+}
@@ -23,4 +23,5 @@ func main() {
 			return git.Provider()
 		},
 	})
+	git.RemoveCheckouts()
 }
@@ -1,14 +1,16 @@
 package map_type
 
+// ToTypedObject returns the string values of the map, values of other types are left out.
 func ToTypedObject(input map[string]interface{}) map[string]string {
 	output := make(map[string]string)
 
 	for k, v := range input {
-		if v == nil {
+		s, ok := v.(string)
+		if !ok {
 			continue
 		}
 
-		output[k] = v.(string)
+		output[k] = s
 	}
 
 	return output
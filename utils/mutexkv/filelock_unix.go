@@ -0,0 +1,21 @@
+//go:build !windows
+
+package mutexkv
+
+import (
+	"os"
+	"syscall"
+)
+
+// Takes an exclusive lock on the file without blocking, returns false when another process holds it
+func tryLockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -1,48 +1,197 @@
 package mutexkv
 
 import (
-	"log"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
+// How often a file lock held by another process is tried again
+const fileLockRetryInterval = 100 * time.Millisecond
+
 // MutexKV is a simple key/value store for arbitrary mutexes. It can be used to
 // serialize changes across arbitrary collaborators that share knowledge of the
-// keys they must serialize on.
+// keys they must serialize on. With a lock directory, a file lock is also held
+// while a key is locked so processes sharing the directory serialize as well.
 type MutexKV struct {
-	lock  sync.Mutex
-	store map[string]*sync.Mutex
+	lock      sync.Mutex
+	store     map[string]*entry
+	dir       string
+	subsystem string
+}
+
+// entry is the mutex of a key, the channel holds a value while it's locked. It
+// counts the callers holding or waiting for it, so it's removed once unused.
+type entry struct {
+	ch   chan struct{}
+	refs int
+	file *os.File
 }
 
 // Locks the mutex for the given key. Caller is responsible for calling Unlock
 // for the same key
 func (m *MutexKV) Lock(key string) {
-	log.Printf("[DEBUG] Locking %q", key)
-	m.get(key).Lock()
-	log.Printf("[DEBUG] Locked %q", key)
+	ctx := context.Background()
+	if err := m.LockContext(ctx, key, 0); err != nil {
+		m.warn(ctx, fmt.Sprintf("Locking %q without the file lock: %s", key, err), key)
+		m.lockProcess(ctx, key)
+		m.debug(ctx, fmt.Sprintf("Locked %q", key), key)
+	}
+}
+
+// LockContext locks the mutex for the given key, giving up when the context is
+// done or after the timeout, unless it's zero. Caller is responsible for calling
+// Unlock for the same key when no error is returned
+func (m *MutexKV) LockContext(ctx context.Context, key string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	m.debug(ctx, fmt.Sprintf("Locking %q", key), key)
+	e, err := m.lockProcess(ctx, key)
+	if err != nil {
+		return err
+	}
+	if m.dir != "" {
+		file, err := lockFile(ctx, m.dir, key)
+		if err != nil {
+			<-e.ch
+			m.release(key, e)
+			return err
+		}
+		e.file = file
+	}
+	m.debug(ctx, fmt.Sprintf("Locked %q", key), key)
+	return nil
 }
 
 // Unlock the mutex for the given key. Caller must have called Lock for the same key first
 func (m *MutexKV) Unlock(key string) {
-	log.Printf("[DEBUG] Unlocking %q", key)
-	m.get(key).Unlock()
-	log.Printf("[DEBUG] Unlocked %q", key)
+	m.UnlockContext(context.Background(), key)
 }
 
-// Returns a mutex for the given key, no guarantee of its lock status
-func (m *MutexKV) get(key string) *sync.Mutex {
+// UnlockContext unlocks the mutex for the given key, logging to the logger of the context.
+// Caller must have called Lock for the same key first
+func (m *MutexKV) UnlockContext(ctx context.Context, key string) {
+	m.debug(ctx, fmt.Sprintf("Unlocking %q", key), key)
 	m.lock.Lock()
-	defer m.lock.Unlock()
-	mutex, ok := m.store[key]
+	e, ok := m.store[key]
+	m.lock.Unlock()
+	if !ok || len(e.ch) == 0 {
+		panic(fmt.Sprintf("mutexkv: unlock of unlocked key %q", key))
+	}
+	if e.file != nil {
+		if err := unlockFile(e.file); err != nil {
+			m.warn(ctx, fmt.Sprintf("Unlocking the file lock of %q: %s", key, err), key)
+		}
+		_ = e.file.Close()
+		e.file = nil
+	}
+	<-e.ch
+	m.release(key, e)
+	m.debug(ctx, fmt.Sprintf("Unlocked %q", key), key)
+}
+
+// WithLogSubsystem makes the MutexKV log to the tflog subsystem instead of the provider logger.
+func (m *MutexKV) WithLogSubsystem(subsystem string) *MutexKV {
+	m.subsystem = subsystem
+	return m
+}
+
+// Logs at debug level to the subsystem if one is set, otherwise to the provider logger
+func (m *MutexKV) debug(ctx context.Context, msg string, key string) {
+	if m.subsystem != "" {
+		tflog.SubsystemDebug(ctx, m.subsystem, msg, map[string]interface{}{"lock_key": key})
+	} else {
+		tflog.Debug(ctx, msg, map[string]interface{}{"lock_key": key})
+	}
+}
+
+// Logs at warn level to the subsystem if one is set, otherwise to the provider logger
+func (m *MutexKV) warn(ctx context.Context, msg string, key string) {
+	if m.subsystem != "" {
+		tflog.SubsystemWarn(ctx, m.subsystem, msg, map[string]interface{}{"lock_key": key})
+	} else {
+		tflog.Warn(ctx, msg, map[string]interface{}{"lock_key": key})
+	}
+}
+
+// Locks the mutex of the key within the process
+func (m *MutexKV) lockProcess(ctx context.Context, key string) (*entry, error) {
+	m.lock.Lock()
+	e, ok := m.store[key]
 	if !ok {
-		mutex = &sync.Mutex{}
-		m.store[key] = mutex
+		e = &entry{ch: make(chan struct{}, 1)}
+		m.store[key] = e
+	}
+	e.refs++
+	m.lock.Unlock()
+
+	select {
+	case e.ch <- struct{}{}:
+		return e, nil
+	case <-ctx.Done():
+		m.release(key, e)
+		return nil, fmt.Errorf("timed out waiting for the lock of %q: %w", key, ctx.Err())
+	}
+}
+
+// Removes the entry of the key once no caller holds or waits for it
+func (m *MutexKV) release(key string, e *entry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e.refs--
+	if e.refs == 0 {
+		delete(m.store, key)
+	}
+}
+
+// Locks the file of the key in dir, trying again until the context is done
+func lockFile(ctx context.Context, dir string, key string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%x.lock", sha256.Sum256([]byte(key))))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", name, err)
+		}
+		if locked {
+			return file, nil
+		}
+		select {
+		case <-ctx.Done():
+			_ = file.Close()
+			return nil, fmt.Errorf("timed out waiting for the lock of %q held by another process: %w", key, ctx.Err())
+		case <-time.After(fileLockRetryInterval):
+		}
 	}
-	return mutex
 }
 
 // Returns a properly initalized MutexKV
 func NewMutexKV() *MutexKV {
 	return &MutexKV{
-		store: make(map[string]*sync.Mutex),
+		store: make(map[string]*entry),
+	}
+}
+
+// Returns a properly initalized MutexKV also holding a file lock under dir
+func NewFileMutexKV(dir string) *MutexKV {
+	return &MutexKV{
+		store: make(map[string]*entry),
+		dir:   dir,
 	}
 }
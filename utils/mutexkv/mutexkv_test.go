@@ -1,6 +1,7 @@
 package mutexkv
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -65,3 +66,69 @@ func TestMutexKVDifferentKeys(t *testing.T) {
 		t.Fatal("Second lock on a different key blocked. This shouldn't happen.")
 	}
 }
+
+func TestMutexKVLockContextTimeout(t *testing.T) {
+	mkv := NewMutexKV()
+
+	mkv.Lock("foo")
+
+	if err := mkv.LockContext(context.Background(), "foo", 50*time.Millisecond); err == nil {
+		t.Fatal("Second lock was able to be taken. This shouldn't happen.")
+	}
+
+	mkv.Unlock("foo")
+
+	if err := mkv.LockContext(context.Background(), "foo", 50*time.Millisecond); err != nil {
+		t.Fatalf("Second lock failed after unlock: %s", err)
+	}
+}
+
+func TestMutexKVCleanup(t *testing.T) {
+	mkv := NewMutexKV()
+
+	mkv.Lock("foo")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mkv.LockContext(ctx, "foo", 0); err == nil {
+		t.Fatal("Lock with a cancelled context was able to be taken. This shouldn't happen.")
+	}
+	mkv.Unlock("foo")
+
+	if len(mkv.store) != 0 {
+		t.Fatalf("Expected no entries left after unlock, got %d", len(mkv.store))
+	}
+}
+
+func TestFileMutexKVLock(t *testing.T) {
+	dir := t.TempDir()
+	// separate MutexKVs only share the file lock, like two processes would
+	first := NewFileMutexKV(dir)
+	second := NewFileMutexKV(dir)
+
+	if err := first.LockContext(context.Background(), "foo", 0); err != nil {
+		t.Fatalf("Lock failed: %s", err)
+	}
+
+	if err := second.LockContext(context.Background(), "foo", 250*time.Millisecond); err == nil {
+		t.Fatal("Second lock was able to be taken. This shouldn't happen.")
+	}
+	if err := second.LockContext(context.Background(), "bar", 250*time.Millisecond); err != nil {
+		t.Fatalf("Second lock on a different key failed: %s", err)
+	}
+
+	doneCh := make(chan struct{})
+
+	go func() {
+		_ = second.LockContext(context.Background(), "foo", time.Second)
+		close(doneCh)
+	}()
+
+	first.Unlock("foo")
+
+	select {
+	case <-doneCh:
+		// pass
+	case <-time.After(time.Second):
+		t.Fatal("Second lock blocked after unlock. This shouldn't happen.")
+	}
+}